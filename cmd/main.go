@@ -2,11 +2,20 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"messenger/internal/db"
 	"messenger/internal/api"
 	"messenger/internal/auth"
+	"messenger/internal/chat"
+	"messenger/internal/realtime"
+	"messenger/internal/storage"
+	"messenger/internal/updates"
+	"messenger/internal/user"
 )
 
 func main() {
@@ -17,10 +26,41 @@ func main() {
 		panic("DB ping error: " + err.Error())
 	}
 
+	// Хранилище вложений: STORAGE_DRIVER=local (каталог STORAGE_DIR) или s3
+	if err := storage.Init(); err != nil {
+		panic("Storage init error: " + err.Error())
+	}
+
+	// Общее ограничение частоты сообщений: MESSAGE_RATE_LIMIT сообщений
+	// за MESSAGE_RATE_INTERVAL (например, 30 и 1m); 0 — без ограничения
+	if err := configureMessageRateLimit(); err != nil {
+		panic("Rate limit config error: " + err.Error())
+	}
+
+	// Записи журналов обновлений хранятся UPDATES_RETENTION (например, 168h);
+	// отставшие сильнее клиенты загружают состояние заново
+	retention, err := updatesRetention()
+	if err != nil {
+		panic("Updates retention config error: " + err.Error())
+	}
+	go runMaintenance(retention)
+
+	// Сетевой статус меняется при первом подключении и закрытии последнего
+	realtime.SetPresenceHandler(user.HandlePresence)
+
 	http.HandleFunc("/register", api.RegisterHandler)
 	http.HandleFunc("/login", api.LoginHandler)
 	http.HandleFunc("/user", auth.AuthMiddleware(api.GetUserHandler))
 	http.HandleFunc("/me", auth.AuthMiddleware(api.GetMeHandler))
+	http.HandleFunc("/settings/privacy", auth.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			api.GetPrivacySettingsHandler(w, r)
+		} else if r.Method == http.MethodPost {
+			api.UpdatePrivacySettingsHandler(w, r)
+		} else {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
 	http.HandleFunc("/contacts", auth.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			api.GetContactsHandler(w, r)
@@ -32,9 +72,115 @@ func main() {
 	}))
 	http.HandleFunc("/chat/private", auth.AuthMiddleware(api.CreatePrivateChatHandler))
 	http.HandleFunc("/chat/group", auth.AuthMiddleware(api.CreateGroupChatHandler))
+	http.HandleFunc("/chat/channel", auth.AuthMiddleware(api.CreateChannelHandler))
+	http.HandleFunc("/chat/join", auth.AuthMiddleware(api.JoinPublicChatHandler))
+	http.HandleFunc("/chat/username", auth.AuthMiddleware(api.SetChatUsernameHandler))
+	http.HandleFunc("/chat/slow-mode", auth.AuthMiddleware(api.SetSlowModeHandler))
+	http.HandleFunc("/chat/preview", auth.AuthMiddleware(api.PublicChatPreviewHandler))
+	http.HandleFunc("/search", auth.AuthMiddleware(api.SearchHandler))
 	http.HandleFunc("/chats", auth.AuthMiddleware(api.GetChatsHandler))
+	http.HandleFunc("/chat/reactions", auth.AuthMiddleware(api.SetAllowedReactionsHandler))
+	http.HandleFunc("/chat/read", auth.AuthMiddleware(api.ReadChatHandler))
+	http.HandleFunc("/chat/typing", auth.AuthMiddleware(api.TypingHandler))
+	http.HandleFunc("/chat/info", auth.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			api.GetChatInfoHandler(w, r)
+		} else if r.Method == http.MethodPost {
+			api.UpdateChatInfoHandler(w, r)
+		} else {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	http.HandleFunc("/chat/members", auth.AuthMiddleware(api.GetChatMembersHandler))
+	http.HandleFunc("/chat/members/add", auth.AuthMiddleware(api.AddMembersHandler))
+	http.HandleFunc("/chat/members/remove", auth.AuthMiddleware(api.RemoveMemberHandler))
+	http.HandleFunc("/chat/leave", auth.AuthMiddleware(api.LeaveChatHandler))
+	http.HandleFunc("/chat/admin", auth.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			api.PromoteAdminHandler(w, r)
+		} else if r.Method == http.MethodDelete {
+			api.DemoteAdminHandler(w, r)
+		} else {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	http.HandleFunc("/chat/owner", auth.AuthMiddleware(api.TransferOwnershipHandler))
+	http.HandleFunc("/chat/ban", auth.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			api.BanMemberHandler(w, r)
+		} else if r.Method == http.MethodDelete {
+			api.UnbanMemberHandler(w, r)
+		} else {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	http.HandleFunc("/chat/bans", auth.AuthMiddleware(api.GetBannedUsersHandler))
+	http.HandleFunc("/chat/restrict", auth.AuthMiddleware(api.RestrictMemberHandler))
+	http.HandleFunc("/chat/invites", auth.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			api.GetInviteLinksHandler(w, r)
+		} else if r.Method == http.MethodPost {
+			api.CreateInviteLinkHandler(w, r)
+		} else {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	http.HandleFunc("/chat/invite/joins", auth.AuthMiddleware(api.GetInviteLinkJoinsHandler))
+	http.HandleFunc("/chat/invite/revoke", auth.AuthMiddleware(api.RevokeInviteLinkHandler))
+	http.HandleFunc("/chat/join-requests", auth.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			api.GetJoinRequestsHandler(w, r)
+		} else if r.Method == http.MethodPost {
+			api.ResolveJoinRequestHandler(w, r)
+		} else {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	http.HandleFunc("/join", auth.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			api.InvitePreviewHandler(w, r)
+		} else if r.Method == http.MethodPost {
+			api.JoinByInviteHandler(w, r)
+		} else {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
 	http.HandleFunc("/message", auth.AuthMiddleware(api.SendMessageHandler))
 	http.HandleFunc("/messages", auth.AuthMiddleware(api.GetMessagesHandler))
+	http.HandleFunc("/message/edit", auth.AuthMiddleware(api.EditMessageHandler))
+	http.HandleFunc("/message/edits", auth.AuthMiddleware(api.GetMessageEditsHandler))
+	http.HandleFunc("/message/delete", auth.AuthMiddleware(api.DeleteMessageHandler))
+	http.HandleFunc("/message/forward", auth.AuthMiddleware(api.ForwardMessagesHandler))
+	http.HandleFunc("/message/views", auth.AuthMiddleware(api.ViewMessagesHandler))
+	http.HandleFunc("/upload", auth.AuthMiddleware(api.UploadHandler))
+	http.HandleFunc("/attachment", auth.AuthMiddleware(api.DownloadAttachmentHandler))
+	http.HandleFunc("/message/pin", auth.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			api.PinMessageHandler(w, r)
+		} else if r.Method == http.MethodDelete {
+			api.UnpinMessageHandler(w, r)
+		} else {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	http.HandleFunc("/message/reaction", auth.AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			api.AddReactionHandler(w, r)
+		} else if r.Method == http.MethodDelete {
+			api.RemoveReactionHandler(w, r)
+		} else {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	http.HandleFunc("/thread", auth.AuthMiddleware(api.GetThreadHandler))
+	http.HandleFunc("/thread/messages", auth.AuthMiddleware(api.GetThreadMessagesHandler))
+	http.HandleFunc("/thread/follow", auth.AuthMiddleware(api.FollowThreadHandler))
+	http.HandleFunc("/thread/read", auth.AuthMiddleware(api.ReadThreadHandler))
+	http.HandleFunc("/threads", auth.AuthMiddleware(api.GetThreadsHandler))
+	http.HandleFunc("/ws", auth.AuthMiddleware(api.WebSocketHandler))
+	http.HandleFunc("/events", auth.AuthMiddleware(api.EventsHandler))
+	http.HandleFunc("/updates/difference", auth.AuthMiddleware(api.GetDifferenceHandler))
+	http.HandleFunc("/updates/channel-difference", auth.AuthMiddleware(api.GetChannelDifferenceHandler))
 
 	// Статические файлы
 	http.Handle("/", http.FileServer(http.Dir("static")))
@@ -42,3 +188,49 @@ func main() {
 	fmt.Println("Messenger server starting on :8080...")
 	http.ListenAndServe(":8080", nil)
 }
+
+// configureMessageRateLimit читает ограничение частоты сообщений из окружения;
+// незаданные значения остаются по умолчанию
+func configureMessageRateLimit() error {
+	limit, interval := chat.DefaultMessageRateLimit, chat.DefaultMessageRateInterval
+	if v := os.Getenv("MESSAGE_RATE_LIMIT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		limit = n
+	}
+	if v := os.Getenv("MESSAGE_RATE_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		interval = d
+	}
+	return chat.SetMessageRateLimit(limit, interval)
+}
+
+// updatesRetention читает срок хранения журналов обновлений из окружения
+func updatesRetention() (time.Duration, error) {
+	v := os.Getenv("UPDATES_RETENTION")
+	if v == "" {
+		return updates.DefaultRetention, nil
+	}
+	return time.ParseDuration(v)
+}
+
+// maintenanceInterval — как часто удаляются устаревшие данные
+const maintenanceInterval = time.Hour
+
+// runMaintenance периодически удаляет устаревшие записи журналов обновлений
+// и вложения, которые так и не были отправлены
+func runMaintenance(retention time.Duration) {
+	for range time.Tick(maintenanceInterval) {
+		if err := updates.Prune(retention); err != nil {
+			log.Printf("prune updates: %v", err)
+		}
+		if err := chat.ExpireUploads(chat.UploadTTL); err != nil {
+			log.Printf("expire uploads: %v", err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"messenger/internal/auth"
+	"messenger/internal/chat"
+	"messenger/internal/models"
+)
+
+type attachmentResponse struct {
+	Success    bool               `json:"success"`
+	Attachment *models.Attachment `json:"attachment,omitempty"`
+	Error      string             `json:"error,omitempty"`
+}
+
+// uploadMemory — сколько байт формы держать в памяти; остальное уходит во временный файл
+const uploadMemory = 8 << 20
+
+// UploadHandler принимает файл в поле file формы multipart/form-data
+func UploadHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	// Запас на заголовки и остальные поля формы
+	r.Body = http.MaxBytesReader(w, r.Body, chat.MaxUploadSize+1<<20)
+	if err := r.ParseMultipartForm(uploadMemory); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(attachmentResponse{Success: false, Error: "invalid upload"})
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(attachmentResponse{Success: false, Error: "missing file"})
+		return
+	}
+	defer file.Close()
+	attachment, err := chat.UploadAttachment(userID, header.Filename, header.Size, file)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(attachmentResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(attachmentResponse{Success: true, Attachment: attachment})
+}
+
+// DownloadAttachmentHandler отдает содержимое вложения, а с параметром thumb —
+// превью изображения с указанной наибольшей стороной
+func DownloadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	attachmentID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(attachmentResponse{Success: false, Error: "invalid id"})
+		return
+	}
+	var maxSide int
+	if v := r.URL.Query().Get("thumb"); v != "" {
+		if maxSide, err = strconv.Atoi(v); err != nil || maxSide <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(attachmentResponse{Success: false, Error: "invalid thumb"})
+			return
+		}
+	}
+	attachment, content, err := chat.OpenAttachment(attachmentID, userID, maxSide)
+	if err == chat.ErrAttachmentNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(attachmentResponse{Success: false, Error: err.Error()})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(attachmentResponse{Success: false, Error: err.Error()})
+		return
+	}
+	defer content.Close()
+	w.Header().Set("Content-Type", attachment.MimeType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	disposition := "attachment"
+	if maxSide != 0 {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Disposition",
+		mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.Copy(w, content)
+}
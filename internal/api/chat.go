@@ -3,6 +3,8 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"time"
 	"messenger/internal/auth"
 	"messenger/internal/chat"
 	"messenger/internal/models"
@@ -17,11 +19,95 @@ type createGroupChatRequest struct {
 	MemberIDs []int  `json:"member_ids"`
 }
 
+type createChannelRequest struct {
+	Name     string `json:"name"`
+	Username string `json:"username"` // обязательно для публичного канала
+	Private  bool   `json:"private"`
+}
+
+type joinPublicChatRequest struct {
+	Username string `json:"username"`
+}
+
+type slowModeRequest struct {
+	ChatID  int `json:"chat_id"`
+	Seconds int `json:"seconds"` // 0 — выключить медленный режим
+}
+
+type chatUsernameRequest struct {
+	ChatID   int    `json:"chat_id"`
+	Username string `json:"username"` // пустое — сделать чат закрытым
+}
+
+type allowedReactionsRequest struct {
+	ChatID           int      `json:"chat_id"`
+	AllowedReactions []string `json:"allowed_reactions"` // null — любые реакции
+}
+
+type readChatRequest struct {
+	ChatID    int `json:"chat_id"`
+	MessageID int `json:"message_id"`
+}
+
+type typingRequest struct {
+	ChatID int    `json:"chat_id"`
+	Action string `json:"action"` // typing или cancel
+}
+
+type addMembersRequest struct {
+	ChatID  int   `json:"chat_id"`
+	UserIDs []int `json:"user_ids"`
+}
+
+type removeMemberRequest struct {
+	ChatID int `json:"chat_id"`
+	UserID int `json:"user_id"`
+}
+
+type banRequest struct {
+	ChatID int `json:"chat_id"`
+	UserID int `json:"user_id"`
+}
+
+type restrictRequest struct {
+	ChatID   int `json:"chat_id"`
+	UserID   int `json:"user_id"`
+	Duration int `json:"duration"` // секунд; 0 — снять ограничение
+}
+
+type leaveChatRequest struct {
+	ChatID int `json:"chat_id"`
+}
+
+type adminRequest struct {
+	ChatID      int      `json:"chat_id"`
+	UserID      int      `json:"user_id"`
+	Permissions []string `json:"permissions"`
+}
+
+type transferOwnershipRequest struct {
+	ChatID int `json:"chat_id"`
+	UserID int `json:"user_id"` // новый владелец
+}
+
+type chatInfoRequest struct {
+	ChatID      int     `json:"chat_id"`
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	AvatarURL   *string `json:"avatar_url"`
+}
+
 type chatResponse struct {
-	Success bool           `json:"success"`
-	Chat    *models.Chat   `json:"chat,omitempty"`
-	Chats   []models.Chat  `json:"chats,omitempty"`
-	Error   string         `json:"error,omitempty"`
+	Success    bool                  `json:"success"`
+	Chat       *models.Chat          `json:"chat,omitempty"`
+	Info       *models.ChatInfo      `json:"info,omitempty"`
+	Preview    *models.ChatPreview   `json:"preview,omitempty"`
+	Chats      []models.ChatListItem `json:"chats,omitempty"`
+	NextOffset int                   `json:"next_offset,omitempty"` // смещение следующей страницы чатов
+	AddedIDs   []int                 `json:"added_ids,omitempty"`   // кто действительно добавлен в группу
+	Members    []models.ChatMember   `json:"members,omitempty"`
+	Banned     []models.BannedUser   `json:"banned,omitempty"`
+	Error      string                `json:"error,omitempty"`
 }
 
 func CreatePrivateChatHandler(w http.ResponseWriter, r *http.Request) {
@@ -58,13 +144,372 @@ func CreateGroupChatHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(chatResponse{Success: true, Chat: chat})
 }
 
+func CreateChannelHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req createChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	chat, err := chat.CreateChannel(req.Name, req.Username, userID, req.Private)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true, Chat: chat})
+}
+
+func JoinPublicChatHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req joinPublicChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	chat, err := chat.JoinPublicChat(req.Username, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true, Chat: chat})
+}
+
+func SetSlowModeHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req slowModeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	chat, err := chat.SetSlowMode(req.ChatID, userID, time.Duration(req.Seconds)*time.Second)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true, Chat: chat})
+}
+
+func SetChatUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req chatUsernameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	chat, err := chat.SetChatUsername(req.ChatID, userID, req.Username)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true, Chat: chat})
+}
+
+func PublicChatPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	preview, err := chat.GetPublicChatPreview(r.URL.Query().Get("username"), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true, Preview: preview})
+}
+
 func GetChatsHandler(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(auth.UserIDKey).(int)
-	chats, err := chat.GetUserChats(userID)
+	var offset, limit int
+	for name, value := range map[string]*int{"offset": &offset, "limit": &limit} {
+		str := r.URL.Query().Get(name)
+		if str == "" {
+			continue
+		}
+		n, err := strconv.Atoi(str)
+		if err != nil || n < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid " + name})
+			return
+		}
+		*value = n
+	}
+	page, err := chat.GetUserChats(userID, offset, limit)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
 		return
 	}
-	json.NewEncoder(w).Encode(chatResponse{Success: true, Chats: chats})
+	json.NewEncoder(w).Encode(chatResponse{Success: true, Chats: page.Chats, NextOffset: page.NextOffset})
+}
+
+func SetAllowedReactionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req allowedReactionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := chat.SetAllowedReactions(req.ChatID, userID, req.AllowedReactions); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true})
+}
+
+func ReadChatHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req readChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := chat.MarkRead(req.ChatID, userID, req.MessageID); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true})
+}
+
+func TypingHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req typingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := chat.SetTyping(req.ChatID, userID, req.Action); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true})
+}
+
+func AddMembersHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req addMembersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	added, err := chat.AddMembers(req.ChatID, userID, req.UserIDs)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true, AddedIDs: added})
+}
+
+func RemoveMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req removeMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := chat.RemoveMember(req.ChatID, userID, req.UserID); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true})
+}
+
+func LeaveChatHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req leaveChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := chat.LeaveChat(req.ChatID, userID); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true})
+}
+
+func GetChatMembersHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	chatID, err := strconv.Atoi(r.URL.Query().Get("chat_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid chat_id"})
+		return
+	}
+	members, err := chat.GetChatMembers(chatID, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true, Members: members})
+}
+
+func PromoteAdminHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req adminRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := chat.PromoteAdmin(req.ChatID, userID, req.UserID, req.Permissions); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true})
+}
+
+func DemoteAdminHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req adminRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := chat.DemoteAdmin(req.ChatID, userID, req.UserID); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true})
+}
+
+func BanMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req banRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := chat.BanMember(req.ChatID, userID, req.UserID); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true})
+}
+
+func UnbanMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req banRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := chat.UnbanMember(req.ChatID, userID, req.UserID); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true})
+}
+
+func GetBannedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	chatID, err := strconv.Atoi(r.URL.Query().Get("chat_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid chat_id"})
+		return
+	}
+	banned, err := chat.GetBannedUsers(chatID, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true, Banned: banned})
+}
+
+func RestrictMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req restrictRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	duration := time.Duration(req.Duration) * time.Second
+	if err := chat.RestrictMember(req.ChatID, userID, req.UserID, duration); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true})
+}
+
+func TransferOwnershipHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req transferOwnershipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := chat.TransferOwnership(req.ChatID, userID, req.UserID); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true})
+}
+
+func GetChatInfoHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	chatID, err := strconv.Atoi(r.URL.Query().Get("chat_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid chat_id"})
+		return
+	}
+	info, err := chat.GetChatInfo(chatID, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true, Info: info})
+}
+
+func UpdateChatInfoHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req chatInfoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	updated, err := chat.UpdateChatInfo(req.ChatID, userID, chat.ChatInfoUpdate{
+		Title:       req.Title,
+		Description: req.Description,
+		AvatarURL:   req.AvatarURL,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(chatResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(chatResponse{Success: true, Chat: updated})
 }
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"messenger/internal/auth"
+	"messenger/internal/realtime"
+)
+
+// EventsHandler отдает события пользователя через Server-Sent Events.
+// Используется клиентами, у которых не работает WebSocket.
+func EventsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	realtime.ServeSSE(w, r, userID, lastEventID(r))
+}
+
+// lastEventID возвращает ID последнего полученного клиентом события.
+// EventSource сам передает заголовок Last-Event-ID при переподключении,
+// параметр last_event_id нужен при первом открытии страницы.
+func lastEventID(r *http.Request) int64 {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0
+	}
+	return id
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+	"messenger/internal/auth"
+	"messenger/internal/chat"
+	"messenger/internal/models"
+)
+
+type createInviteLinkRequest struct {
+	ChatID           int  `json:"chat_id"`
+	ExpireIn         int  `json:"expire_in"` // секунд; 0 — бессрочная
+	MaxUses          int  `json:"max_uses"`  // 0 — без ограничения
+	RequiresApproval bool `json:"requires_approval"`
+}
+
+type revokeInviteLinkRequest struct {
+	LinkID int `json:"link_id"`
+}
+
+type joinRequest struct {
+	Token string `json:"token"`
+}
+
+type resolveJoinRequestRequest struct {
+	ChatID  int  `json:"chat_id"`
+	UserID  int  `json:"user_id"`
+	Approve bool `json:"approve"`
+}
+
+type inviteResponse struct {
+	Success  bool                  `json:"success"`
+	Link     *models.InviteLink    `json:"link,omitempty"`
+	Links    []models.InviteLink   `json:"links,omitempty"`
+	Joins    []models.InviteJoin   `json:"joins,omitempty"`
+	Requests []models.JoinRequest  `json:"requests,omitempty"`
+	Preview  *models.InvitePreview `json:"preview,omitempty"`
+	ChatID   int                   `json:"chat_id,omitempty"`
+	Pending  bool                  `json:"pending,omitempty"` // заявка ждет одобрения
+	Error    string                `json:"error,omitempty"`
+}
+
+func CreateInviteLinkHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req createInviteLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(inviteResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	link, err := chat.CreateInviteLink(req.ChatID, userID, chat.InviteLinkOptions{
+		ExpireIn:         time.Duration(req.ExpireIn) * time.Second,
+		MaxUses:          req.MaxUses,
+		RequiresApproval: req.RequiresApproval,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(inviteResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(inviteResponse{Success: true, Link: link})
+}
+
+func GetInviteLinksHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	chatID, err := strconv.Atoi(r.URL.Query().Get("chat_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(inviteResponse{Success: false, Error: "invalid chat_id"})
+		return
+	}
+	links, err := chat.GetInviteLinks(chatID, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(inviteResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(inviteResponse{Success: true, Links: links})
+}
+
+func GetInviteLinkJoinsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	linkID, err := strconv.Atoi(r.URL.Query().Get("link_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(inviteResponse{Success: false, Error: "invalid link_id"})
+		return
+	}
+	joins, err := chat.GetInviteLinkJoins(linkID, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(inviteResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(inviteResponse{Success: true, Joins: joins})
+}
+
+func RevokeInviteLinkHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req revokeInviteLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(inviteResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := chat.RevokeInviteLink(req.LinkID, userID); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(inviteResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(inviteResponse{Success: true})
+}
+
+func InvitePreviewHandler(w http.ResponseWriter, r *http.Request) {
+	preview, err := chat.GetInvitePreview(r.URL.Query().Get("token"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(inviteResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(inviteResponse{Success: true, Preview: preview})
+}
+
+func JoinByInviteHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req joinRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(inviteResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	result, err := chat.JoinByInviteLink(req.Token, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(inviteResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(inviteResponse{Success: true, ChatID: result.ChatID, Pending: result.Pending})
+}
+
+func GetJoinRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	chatID, err := strconv.Atoi(r.URL.Query().Get("chat_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(inviteResponse{Success: false, Error: "invalid chat_id"})
+		return
+	}
+	requests, err := chat.GetJoinRequests(chatID, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(inviteResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(inviteResponse{Success: true, Requests: requests})
+}
+
+func ResolveJoinRequestHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req resolveJoinRequestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(inviteResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := chat.ResolveJoinRequest(req.ChatID, userID, req.UserID, req.Approve); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(inviteResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(inviteResponse{Success: true})
+}
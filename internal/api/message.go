@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"messenger/internal/auth"
@@ -10,15 +11,76 @@ import (
 )
 
 type sendMessageRequest struct {
-	ChatID int    `json:"chat_id"`
-	Text   string `json:"text"`
+	ChatID           int    `json:"chat_id"`
+	Text             string `json:"text"`
+	ReplyToMessageID int    `json:"reply_to_message_id"`
+	ThreadRootID     int    `json:"thread_root_id"`
+	AttachmentIDs    []int  `json:"attachment_ids"` // вложения, загруженные через /upload
+}
+
+type editMessageRequest struct {
+	MessageID int    `json:"message_id"`
+	Text      string `json:"text"`
+}
+
+type deleteMessageRequest struct {
+	MessageID   int  `json:"message_id"`
+	ForEveryone bool `json:"for_everyone"`
+}
+
+type forwardMessagesRequest struct {
+	FromChatID int   `json:"from_chat_id"`
+	MessageIDs []int `json:"message_ids"`
+	ToChatID   int   `json:"to_chat_id"`
+}
+
+type reactionRequest struct {
+	MessageID int    `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
+
+type pinMessageRequest struct {
+	MessageID int `json:"message_id"`
+}
+
+type viewMessagesRequest struct {
+	ChatID     int   `json:"chat_id"`
+	MessageIDs []int `json:"message_ids"`
 }
 
 type messageResponse struct {
-	Success  bool              `json:"success"`
-	Message  *models.Message   `json:"message,omitempty"`
-	Messages []models.Message  `json:"messages,omitempty"`
-	Error    string            `json:"error,omitempty"`
+	Success       bool                 `json:"success"`
+	Message       *models.Message      `json:"message,omitempty"`
+	Messages      []models.Message     `json:"messages,omitempty"`
+	HasMoreBefore bool                 `json:"has_more_before,omitempty"`
+	HasMoreAfter  bool                 `json:"has_more_after,omitempty"`
+	Edits         []models.MessageEdit `json:"edits,omitempty"`
+	Views         map[int]int          `json:"views,omitempty"`       // просмотры постов по их ID
+	RetryAfter    int                  `json:"retry_after,omitempty"` // секунд до следующей попытки отправки
+	Error         string               `json:"error,omitempty"`
+}
+
+func (req sendMessageRequest) options() chat.SendOptions {
+	return chat.SendOptions{
+		ReplyToMessageID: req.ReplyToMessageID,
+		ThreadRootID:     req.ThreadRootID,
+		AttachmentIDs:    req.AttachmentIDs,
+	}
+}
+
+// writeSendError отдает ошибку отправки; при превышении частоты — 429
+// с заголовком Retry-After
+func writeSendError(w http.ResponseWriter, err error) {
+	var limited *chat.RateLimitError
+	if errors.As(err, &limited) {
+		w.Header().Set("Retry-After", strconv.Itoa(limited.RetrySeconds()))
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: err.Error(),
+			RetryAfter: limited.RetrySeconds()})
+		return
+	}
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(messageResponse{Success: false, Error: err.Error()})
 }
 
 func SendMessageHandler(w http.ResponseWriter, r *http.Request) {
@@ -29,15 +91,42 @@ func SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: "invalid request"})
 		return
 	}
-	message, err := chat.SendMessage(req.ChatID, userID, req.Text)
+	message, err := chat.SendMessage(req.ChatID, userID, req.Text, req.options())
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: err.Error()})
+		writeSendError(w, err)
 		return
 	}
 	json.NewEncoder(w).Encode(messageResponse{Success: true, Message: message})
 }
 
+// parseMessagesQuery разбирает параметры постраничной выборки сообщений
+func parseMessagesQuery(r *http.Request) (chat.MessagesQuery, error) {
+	limitStr := r.URL.Query().Get("limit")
+	query := chat.MessagesQuery{Limit: 50}
+	if limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			query.Limit = l
+		}
+	}
+	cursors := map[string]*int{
+		"before_id": &query.BeforeID,
+		"after_id":  &query.AfterID,
+		"around_id": &query.AroundID,
+	}
+	for name, cursor := range cursors {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			return query, errors.New("invalid " + name)
+		}
+		*cursor = id
+	}
+	return query, nil
+}
+
 func GetMessagesHandler(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(auth.UserIDKey).(int)
 	chatIDStr := r.URL.Query().Get("chat_id")
@@ -52,18 +141,177 @@ func GetMessagesHandler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: "invalid chat_id"})
 		return
 	}
-	limitStr := r.URL.Query().Get("limit")
-	limit := 50
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
-		}
+	query, err := parseMessagesQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: err.Error()})
+		return
+	}
+	query.IncludeThreads = r.URL.Query().Get("include_threads") == "true"
+	page, err := chat.GetChatMessages(chatID, userID, query)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(messageResponse{
+		Success:       true,
+		Messages:      page.Messages,
+		HasMoreBefore: page.HasMoreBefore,
+		HasMoreAfter:  page.HasMoreAfter,
+	})
+}
+
+func EditMessageHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req editMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	message, err := chat.EditMessage(req.MessageID, userID, req.Text)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: err.Error()})
+		return
 	}
-	messages, err := chat.GetChatMessages(chatID, userID, limit)
+	json.NewEncoder(w).Encode(messageResponse{Success: true, Message: message})
+}
+
+func GetMessageEditsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	messageID, err := strconv.Atoi(r.URL.Query().Get("message_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: "invalid message_id"})
+		return
+	}
+	edits, err := chat.GetMessageEdits(messageID, userID)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: err.Error()})
 		return
 	}
+	json.NewEncoder(w).Encode(messageResponse{Success: true, Edits: edits})
+}
+
+func DeleteMessageHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req deleteMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := deleteMessage(req, userID); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(messageResponse{Success: true})
+}
+
+func deleteMessage(req deleteMessageRequest, userID int) error {
+	if req.ForEveryone {
+		return chat.DeleteMessageForEveryone(req.MessageID, userID)
+	}
+	return chat.DeleteMessageForMe(req.MessageID, userID)
+}
+
+func ForwardMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req forwardMessagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	messages, err := chat.ForwardMessages(req.FromChatID, req.MessageIDs, req.ToChatID, userID)
+	if err != nil {
+		writeSendError(w, err)
+		return
+	}
 	json.NewEncoder(w).Encode(messageResponse{Success: true, Messages: messages})
 }
+
+func AddReactionHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req reactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := chat.AddReaction(req.MessageID, userID, req.Emoji); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(messageResponse{Success: true})
+}
+
+func RemoveReactionHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req reactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := chat.RemoveReaction(req.MessageID, userID, req.Emoji); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(messageResponse{Success: true})
+}
+
+func PinMessageHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req pinMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := chat.PinMessage(req.MessageID, userID); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(messageResponse{Success: true})
+}
+
+func UnpinMessageHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req pinMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := chat.UnpinMessage(req.MessageID, userID); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(messageResponse{Success: true})
+}
+
+func ViewMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req viewMessagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	views, err := chat.ViewMessages(req.ChatID, userID, req.MessageIDs)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(messageResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(messageResponse{Success: true, Views: views})
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"messenger/internal/auth"
+	"messenger/internal/chat"
+	"messenger/internal/models"
+	"messenger/internal/user"
+)
+
+type searchResponse struct {
+	Success bool                 `json:"success"`
+	Users   []models.User        `json:"users"`
+	Chats   []models.ChatPreview `json:"chats"`
+	Error   string               `json:"error,omitempty"`
+}
+
+func SearchHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	query := strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("q")), "@")
+	if query == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(searchResponse{Success: false, Error: "missing query"})
+		return
+	}
+	users, err := user.SearchUsers(userID, query)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(searchResponse{Success: false, Error: err.Error()})
+		return
+	}
+	chats, err := chat.SearchPublicChats(query)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(searchResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(searchResponse{Success: true, Users: users, Chats: chats})
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"messenger/internal/auth"
+	"messenger/internal/models"
+	"messenger/internal/user"
+)
+
+type privacyResponse struct {
+	Success  bool                    `json:"success"`
+	Settings *models.PrivacySettings `json:"settings,omitempty"`
+	Error    string                  `json:"error,omitempty"`
+}
+
+func GetPrivacySettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	settings, err := user.GetPrivacySettings(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(privacyResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(privacyResponse{Success: true, Settings: settings})
+}
+
+func UpdatePrivacySettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	// Поля, не переданные в запросе, сохраняют текущие значения
+	settings, err := user.GetPrivacySettings(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(privacyResponse{Success: false, Error: err.Error()})
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(settings); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(privacyResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := user.UpdatePrivacySettings(userID, *settings); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(privacyResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(privacyResponse{Success: true, Settings: settings})
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"messenger/internal/auth"
+	"messenger/internal/chat"
+	"messenger/internal/models"
+)
+
+type followThreadRequest struct {
+	RootMessageID int  `json:"root_message_id"`
+	Follow        bool `json:"follow"`
+}
+
+type readThreadRequest struct {
+	RootMessageID int `json:"root_message_id"`
+	MessageID     int `json:"message_id"`
+}
+
+type threadResponse struct {
+	Success       bool             `json:"success"`
+	Thread        *models.Thread   `json:"thread,omitempty"`
+	Threads       []models.Thread  `json:"threads,omitempty"`
+	Messages      []models.Message `json:"messages,omitempty"`
+	HasMoreBefore bool             `json:"has_more_before,omitempty"`
+	HasMoreAfter  bool             `json:"has_more_after,omitempty"`
+	Error         string           `json:"error,omitempty"`
+}
+
+func GetThreadHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	rootID, err := strconv.Atoi(r.URL.Query().Get("root_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(threadResponse{Success: false, Error: "invalid root_id"})
+		return
+	}
+	thread, err := chat.GetThread(rootID, userID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(threadResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(threadResponse{Success: true, Thread: thread})
+}
+
+func GetThreadMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	rootID, err := strconv.Atoi(r.URL.Query().Get("root_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(threadResponse{Success: false, Error: "invalid root_id"})
+		return
+	}
+	query, err := parseMessagesQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(threadResponse{Success: false, Error: err.Error()})
+		return
+	}
+	page, err := chat.GetThreadMessages(rootID, userID, query)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(threadResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(threadResponse{
+		Success:       true,
+		Messages:      page.Messages,
+		HasMoreBefore: page.HasMoreBefore,
+		HasMoreAfter:  page.HasMoreAfter,
+	})
+}
+
+func GetThreadsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	threads, err := chat.GetFollowedThreads(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(threadResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(threadResponse{Success: true, Threads: threads})
+}
+
+func FollowThreadHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req followThreadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(threadResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := chat.FollowThread(req.RootMessageID, userID, req.Follow); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(threadResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(threadResponse{Success: true})
+}
+
+func ReadThreadHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	var req readThreadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(threadResponse{Success: false, Error: "invalid request"})
+		return
+	}
+	if err := chat.MarkThreadRead(req.RootMessageID, userID, req.MessageID); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(threadResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(threadResponse{Success: true})
+}
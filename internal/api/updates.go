@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"messenger/internal/auth"
+	"messenger/internal/chat"
+	"messenger/internal/models"
+	"messenger/internal/updates"
+)
+
+type differenceResponse struct {
+	Success bool            `json:"success"`
+	Updates []models.Update `json:"updates,omitempty"`
+	Pts     int64           `json:"pts"`
+	TooLong bool            `json:"too_long,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+func GetDifferenceHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	sinceStr := r.URL.Query().Get("since")
+	if sinceStr == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(differenceResponse{Success: false, Error: "missing since"})
+		return
+	}
+	since, err := strconv.ParseInt(sinceStr, 10, 64)
+	if err != nil || since < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(differenceResponse{Success: false, Error: "invalid since"})
+		return
+	}
+	diff, err := updates.GetDifference(userID, since)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(differenceResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(differenceResponse{
+		Success: true,
+		Updates: diff.Updates,
+		Pts:     diff.Pts,
+		TooLong: diff.TooLong,
+	})
+}
+
+func GetChannelDifferenceHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	chatID, err := strconv.Atoi(r.URL.Query().Get("chat_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(differenceResponse{Success: false, Error: "invalid chat_id"})
+		return
+	}
+	since, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+	if err != nil || since < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(differenceResponse{Success: false, Error: "invalid since"})
+		return
+	}
+	diff, err := chat.GetChannelDifference(chatID, userID, since)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(differenceResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(differenceResponse{
+		Success: true,
+		Updates: diff.Updates,
+		Pts:     diff.Pts,
+		TooLong: diff.TooLong,
+	})
+}
@@ -16,6 +16,7 @@ type userResponse struct {
 }
 
 func GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	viewerID := r.Context().Value(auth.UserIDKey).(int)
 	userIDStr := r.URL.Query().Get("id")
 	if userIDStr == "" {
 		w.WriteHeader(http.StatusBadRequest)
@@ -34,7 +35,7 @@ func GetUserHandler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(userResponse{Success: false, Error: err.Error()})
 		return
 	}
-	json.NewEncoder(w).Encode(userResponse{Success: true, User: user})
+	writeUser(w, viewerID, user)
 }
 
 func GetMeHandler(w http.ResponseWriter, r *http.Request) {
@@ -45,5 +46,15 @@ func GetMeHandler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(userResponse{Success: false, Error: err.Error()})
 		return
 	}
-	json.NewEncoder(w).Encode(userResponse{Success: true, User: user})
+	writeUser(w, userID, user)
+}
+
+// writeUser отдает пользователя вместе с его статусом присутствия
+func writeUser(w http.ResponseWriter, viewerID int, u *models.User) {
+	if err := user.AttachPresence(viewerID, []*models.User{u}); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(userResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(userResponse{Success: true, User: u})
 }
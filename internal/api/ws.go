@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"messenger/internal/auth"
+	"messenger/internal/chat"
+	"messenger/internal/realtime"
+
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// WebSocketHandler открывает WebSocket-подключение для получения событий
+// в реальном времени и отправки сообщений
+func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(auth.UserIDKey).(int)
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade уже ответил клиенту с ошибкой
+		return
+	}
+	client := realtime.NewClient(userID, conn, handleSocketFrame)
+	client.Run(lastEventID(r))
+}
+
+// handleSocketFrame обрабатывает кадры, присланные клиентом через WebSocket
+func handleSocketFrame(c *realtime.Client, frame realtime.Frame) (interface{}, error) {
+	switch frame.Type {
+	case "send_message":
+		var req sendMessageRequest
+		if err := json.Unmarshal(frame.Data, &req); err != nil {
+			return nil, errors.New("invalid request")
+		}
+		return chat.SendMessage(req.ChatID, c.UserID, req.Text, req.options())
+	case "edit_message":
+		var req editMessageRequest
+		if err := json.Unmarshal(frame.Data, &req); err != nil {
+			return nil, errors.New("invalid request")
+		}
+		return chat.EditMessage(req.MessageID, c.UserID, req.Text)
+	case "forward_messages":
+		var req forwardMessagesRequest
+		if err := json.Unmarshal(frame.Data, &req); err != nil {
+			return nil, errors.New("invalid request")
+		}
+		return chat.ForwardMessages(req.FromChatID, req.MessageIDs, req.ToChatID, c.UserID)
+	case "typing":
+		var req typingRequest
+		if err := json.Unmarshal(frame.Data, &req); err != nil {
+			return nil, errors.New("invalid request")
+		}
+		return nil, chat.SetTyping(req.ChatID, c.UserID, req.Action)
+	case "read":
+		var req readChatRequest
+		if err := json.Unmarshal(frame.Data, &req); err != nil {
+			return nil, errors.New("invalid request")
+		}
+		return nil, chat.MarkRead(req.ChatID, c.UserID, req.MessageID)
+	case "delete_message":
+		var req deleteMessageRequest
+		if err := json.Unmarshal(frame.Data, &req); err != nil {
+			return nil, errors.New("invalid request")
+		}
+		return nil, deleteMessage(req, c.UserID)
+	default:
+		return nil, errors.New("unknown frame type")
+	}
+}
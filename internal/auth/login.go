@@ -10,7 +10,7 @@ import (
 // LoginUser проверяет логин и пароль, возвращает JWT-токен
 func LoginUser(emailOrUsername, password string) (string, error) {
 	var user models.User
-	err := db.DB.Get(&user, "SELECT * FROM users WHERE email=$1 OR username=$1", emailOrUsername)
+	err := db.DB.Get(&user, "SELECT id, username, email, password FROM users WHERE email=$1 OR username=$1", emailOrUsername)
 	if err != nil {
 		return "", errors.New("user not found")
 	}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"strings"
+	"messenger/internal/user"
 	"messenger/internal/utils"
 )
 
@@ -13,13 +14,8 @@ const UserIDKey contextKey = "user_id"
 // AuthMiddleware проверяет JWT-токен и добавляет user_id в контекст
 func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
+		tokenString := tokenFromRequest(r)
+		if tokenString == "" {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
@@ -28,7 +24,27 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
+		user.Touch(userID)
 		ctx := context.WithValue(r.Context(), UserIDKey, userID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
+
+// tokenFromRequest достает токен из заголовка Authorization.
+// Браузер не умеет передавать заголовки при открытии WebSocket и EventSource,
+// поэтому для таких запросов токен принимается и из параметра token.
+func tokenFromRequest(r *http.Request) string {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader != "" {
+		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		if tokenString == authHeader {
+			return ""
+		}
+		return tokenString
+	}
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return r.URL.Query().Get("token")
+	}
+	return ""
+}
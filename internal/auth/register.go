@@ -3,6 +3,7 @@ package auth
 import (
 	"errors"
 	"messenger/internal/db"
+	"messenger/internal/user"
 	"messenger/internal/utils"
 )
 
@@ -17,23 +18,30 @@ func RegisterUser(username, email, password string) error {
 	if count > 0 {
 		return errors.New("email already in use")
 	}
-	// Проверка уникальности username
-	err = db.DB.Get(&count, "SELECT COUNT(*) FROM users WHERE username=$1", username)
+	// Хешируем пароль
+	hash, err := utils.HashPassword(password)
 	if err != nil {
 		return err
 	}
-	if count > 0 {
-		return errors.New("username already in use")
-	}
-	// Хешируем пароль
-	hash, err := utils.HashPassword(password)
+	// Сохраняем пользователя и занимаем имя; оно общее с публичными чатами
+	tx, err := db.DB.Beginx()
 	if err != nil {
 		return err
 	}
-	// Сохраняем пользователя
-	_, err = db.DB.Exec(
-		"INSERT INTO users (username, email, password) VALUES ($1, $2, $3)",
+	defer tx.Rollback()
+	var userID int
+	err = tx.QueryRow(
+		"INSERT INTO users (username, email, password) VALUES ($1, $2, $3) RETURNING id",
 		username, email, hash,
-	)
-	return err
+	).Scan(&userID)
+	if err != nil {
+		return err
+	}
+	if err := user.ClaimUsername(tx, username, userID, 0); err != nil {
+		if err == user.ErrUsernameTaken {
+			return errors.New("username already in use")
+		}
+		return err
+	}
+	return tx.Commit()
 }
@@ -0,0 +1,370 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"messenger/internal/db"
+	"messenger/internal/media"
+	"messenger/internal/models"
+	"messenger/internal/storage"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	// MaxUploadSize — наибольший размер загружаемого файла
+	MaxUploadSize = 50 << 20
+	// MaxMessageAttachments — сколько вложений можно приложить к одному сообщению
+	MaxMessageAttachments = 10
+	// maxFilenameLength — длиннее имена файлов обрезаются
+	maxFilenameLength = 255
+	// UploadTTL — сколько хранится вложение, так и не приложенное к сообщению
+	UploadTTL = 24 * time.Hour
+)
+
+// ErrAttachmentNotFound возвращается, если вложения нет или оно недоступно пользователю
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+// newStorageKey возвращает случайный ключ содержимого в хранилище
+func newStorageKey() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// cleanFilename оставляет от присланного имени только имя файла без пути
+func cleanFilename(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, `\`, "/")))
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	for len(name) > maxFilenameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
+
+// detectMimeType определяет тип по содержимому, а если оно не распознано —
+// по расширению файла
+func detectMimeType(head []byte, filename string) string {
+	sniffed := http.DetectContentType(head)
+	if sniffed != "application/octet-stream" {
+		return sniffed
+	}
+	if byExt := mime.TypeByExtension(filepath.Ext(filename)); byExt != "" {
+		return byExt
+	}
+	return sniffed
+}
+
+// UploadAttachment сохраняет файл в хранилище. Вложение доступно загрузившему,
+// а после отправки сообщения с ним — и участникам чата. Из изображений
+// удаляются геоданные, для них сохраняются размеры, превью и BlurHash.
+func UploadAttachment(userID int, filename string, size int64, r io.Reader) (*models.Attachment, error) {
+	if size <= 0 {
+		return nil, errors.New("file is empty")
+	}
+	if size > MaxUploadSize {
+		return nil, errors.New("file is too large")
+	}
+	filename = cleanFilename(filename)
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+	key, err := newStorageKey()
+	if err != nil {
+		return nil, err
+	}
+	mimeType := detectMimeType(head, filename)
+	var content io.Reader = io.MultiReader(bytes.NewReader(head), r)
+	var img *media.Image
+	if media.Supported(mimeType) {
+		data, err := io.ReadAll(io.LimitReader(content, size))
+		if err != nil {
+			return nil, err
+		}
+		// Изображение, которое не удалось разобрать, сохраняется как обычный файл
+		if img, err = media.Process(data, mimeType); err != nil {
+			img = nil
+		}
+		content = bytes.NewReader(data)
+	}
+	ctx := context.Background()
+	if err := storage.Files.Put(ctx, key, content, size, mimeType); err != nil {
+		return nil, err
+	}
+	// Если сохранить вложение не удалось, загруженное в хранилище удаляется
+	keys := []string{key}
+	cleanup := func() {
+		for _, k := range keys {
+			storage.Files.Delete(ctx, k)
+		}
+	}
+	attachment := &models.Attachment{UploaderID: userID, StorageKey: key, Filename: filename,
+		MimeType: mimeType, Size: size}
+	if img != nil {
+		attachment.Width, attachment.Height, attachment.Blurhash = img.Width, img.Height, img.Blurhash
+		for _, t := range img.Thumbnails {
+			thumbKey := key + "-" + strconv.Itoa(t.MaxSide)
+			err := storage.Files.Put(ctx, thumbKey, bytes.NewReader(t.Data), int64(len(t.Data)), "image/jpeg")
+			if err != nil {
+				cleanup()
+				return nil, err
+			}
+			keys = append(keys, thumbKey)
+			attachment.Thumbnails = append(attachment.Thumbnails, models.Thumbnail{MaxSide: t.MaxSide,
+				StorageKey: thumbKey, Width: t.Width, Height: t.Height, Size: int64(len(t.Data))})
+		}
+	}
+	if err := saveAttachment(attachment); err != nil {
+		cleanup()
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// saveAttachment записывает вложение вместе с его превью
+func saveAttachment(attachment *models.Attachment) error {
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = tx.QueryRow(`
+		INSERT INTO attachments (uploader_id, storage_key, filename, mime_type, size, width, height, blurhash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at
+	`, attachment.UploaderID, attachment.StorageKey, attachment.Filename, attachment.MimeType,
+		attachment.Size, attachment.Width, attachment.Height, attachment.Blurhash,
+	).Scan(&attachment.ID, &attachment.CreatedAt)
+	if err != nil {
+		return err
+	}
+	for i := range attachment.Thumbnails {
+		t := &attachment.Thumbnails[i]
+		t.AttachmentID = attachment.ID
+		_, err := tx.Exec(`
+			INSERT INTO attachment_thumbnails (attachment_id, max_side, storage_key, width, height, size)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, t.AttachmentID, t.MaxSide, t.StorageKey, t.Width, t.Height, t.Size)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// OpenAttachment открывает содержимое вложения или, если maxSide не ноль, его превью.
+// Скачать его может загрузивший, участник чата, где оно отправлено,
+// и любой пользователь, если чат публичный. Возвращаются сведения
+// об отдаваемом файле.
+func OpenAttachment(attachmentID, userID, maxSide int) (*models.Attachment, io.ReadCloser, error) {
+	var attachment models.Attachment
+	err := db.DB.Get(&attachment, `
+		SELECT a.* FROM attachments a
+		WHERE a.id = $1 AND (a.uploader_id = $2 OR EXISTS (
+			SELECT 1 FROM message_attachments ma
+			JOIN messages m ON m.id = ma.message_id AND m.deleted_at IS NULL
+			JOIN chats c ON c.id = m.chat_id
+			WHERE ma.attachment_id = a.id AND (c.username IS NOT NULL OR EXISTS (
+				SELECT 1 FROM chat_members cm WHERE cm.chat_id = m.chat_id AND cm.user_id = $2
+			))
+		))
+	`, attachmentID, userID)
+	if err != nil {
+		return nil, nil, ErrAttachmentNotFound
+	}
+	if maxSide != 0 {
+		var thumb models.Thumbnail
+		err := db.DB.Get(&thumb, "SELECT * FROM attachment_thumbnails WHERE attachment_id=$1 AND max_side=$2",
+			attachmentID, maxSide)
+		if err != nil {
+			return nil, nil, ErrAttachmentNotFound
+		}
+		attachment.StorageKey, attachment.MimeType, attachment.Size = thumb.StorageKey, "image/jpeg", thumb.Size
+	}
+	content, err := storage.Files.Get(context.Background(), attachment.StorageKey)
+	if err == storage.ErrNotFound {
+		return nil, nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &attachment, content, nil
+}
+
+// attachToMessage прикладывает к сообщению вложения, загруженные отправителем
+func attachToMessage(tx *sqlx.Tx, messageID, userID int, attachmentIDs []int) error {
+	if len(attachmentIDs) == 0 {
+		return nil
+	}
+	if len(attachmentIDs) > MaxMessageAttachments {
+		return errors.New("too many attachments")
+	}
+	ids := make([]int64, len(attachmentIDs))
+	for i, id := range attachmentIDs {
+		ids[i] = int64(id)
+	}
+	// Порядок вложений совпадает с порядком в запросе; повторы пропускаются
+	result, err := tx.Exec(`
+		INSERT INTO message_attachments (message_id, attachment_id, position)
+		SELECT $1, a.id, MIN(req.position)
+		FROM unnest($2::int[]) WITH ORDINALITY AS req(id, position)
+		JOIN attachments a ON a.id = req.id AND a.uploader_id = $3
+		GROUP BY a.id
+	`, messageID, pq.Array(ids), userID)
+	if err != nil {
+		return err
+	}
+	unique := make(map[int]struct{}, len(attachmentIDs))
+	for _, id := range attachmentIDs {
+		unique[id] = struct{}{}
+	}
+	if n, _ := result.RowsAffected(); int(n) != len(unique) {
+		return ErrAttachmentNotFound
+	}
+	return nil
+}
+
+// deleteUnusedAttachments удаляет вложения из списка, которые больше не приложены
+// ни к одному сообщению, вместе с их превью. Возвращает ключи содержимого,
+// которое нужно удалить из хранилища после фиксации.
+func deleteUnusedAttachments(tx *sqlx.Tx, attachmentIDs []int64) ([]string, error) {
+	if len(attachmentIDs) == 0 {
+		return nil, nil
+	}
+	var keys []string
+	err := tx.Select(&keys, `
+		WITH removed AS (
+			DELETE FROM attachments a
+			WHERE a.id = ANY($1) AND NOT EXISTS (
+				SELECT 1 FROM message_attachments ma WHERE ma.attachment_id = a.id
+			)
+			RETURNING a.id, a.storage_key
+		), thumbs AS (
+			DELETE FROM attachment_thumbnails t USING removed
+			WHERE t.attachment_id = removed.id
+			RETURNING t.storage_key
+		)
+		SELECT storage_key FROM removed
+		UNION ALL
+		SELECT storage_key FROM thumbs
+	`, pq.Array(attachmentIDs))
+	return keys, err
+}
+
+// deleteFiles удаляет содержимое удаленных вложений из хранилища. Записи
+// о вложениях уже удалены, поэтому ошибки только пишутся в лог.
+func deleteFiles(keys []string) {
+	ctx := context.Background()
+	for _, key := range keys {
+		if err := storage.Files.Delete(ctx, key); err != nil {
+			log.Printf("delete file %s: %v", key, err)
+		}
+	}
+}
+
+// ExpireUploads удаляет вложения, загруженные больше ttl назад
+// и так и не приложенные ни к одному сообщению
+func ExpireUploads(ttl time.Duration) error {
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var ids []int64
+	err = tx.Select(&ids, `
+		SELECT a.id FROM attachments a
+		WHERE a.created_at < now() - $1::float8 * interval '1 second' AND NOT EXISTS (
+			SELECT 1 FROM message_attachments ma WHERE ma.attachment_id = a.id
+		)
+	`, ttl.Seconds())
+	if err != nil {
+		return err
+	}
+	keys, err := deleteUnusedAttachments(tx, ids)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	deleteFiles(keys)
+	return nil
+}
+
+// copyAttachments прикладывает к пересланному сообщению вложения оригинала
+func copyAttachments(tx *sqlx.Tx, fromMessageID, toMessageID int) error {
+	_, err := tx.Exec(`
+		INSERT INTO message_attachments (message_id, attachment_id, position)
+		SELECT $2, attachment_id, position FROM message_attachments WHERE message_id = $1
+	`, fromMessageID, toMessageID)
+	return err
+}
+
+// loadAttachments загружает вложения сообщений одним запросом
+func loadAttachments(q sqlx.Queryer, messages []*models.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(messages))
+	for i, m := range messages {
+		ids[i] = int64(m.ID)
+	}
+	var rows []struct {
+		MessageID int `db:"message_id"`
+		models.Attachment
+	}
+	err := sqlx.Select(q, &rows, `
+		SELECT ma.message_id, a.* FROM message_attachments ma
+		JOIN attachments a ON a.id = ma.attachment_id
+		WHERE ma.message_id = ANY($1)
+		ORDER BY ma.message_id, ma.position
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	attachmentIDs := make([]int64, len(rows))
+	for i, row := range rows {
+		attachmentIDs[i] = int64(row.ID)
+	}
+	var thumbs []models.Thumbnail
+	err = sqlx.Select(q, &thumbs, `
+		SELECT * FROM attachment_thumbnails WHERE attachment_id = ANY($1)
+		ORDER BY attachment_id, max_side
+	`, pq.Array(attachmentIDs))
+	if err != nil {
+		return err
+	}
+	byAttachment := make(map[int][]models.Thumbnail)
+	for _, t := range thumbs {
+		byAttachment[t.AttachmentID] = append(byAttachment[t.AttachmentID], t)
+	}
+	byMessage := make(map[int][]models.Attachment)
+	for _, row := range rows {
+		row.Thumbnails = byAttachment[row.ID]
+		byMessage[row.MessageID] = append(byMessage[row.MessageID], row.Attachment)
+	}
+	for _, m := range messages {
+		m.Attachments = byMessage[m.ID]
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"messenger/internal/db"
+	"messenger/internal/models"
+	"messenger/internal/realtime"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Действия события members_changed при блокировках и ограничениях
+const (
+	membersBanned     = "banned"
+	membersUnbanned   = "unbanned"
+	membersRestricted = "restricted"
+)
+
+// ErrBanned возвращается заблокированному пользователю при попытке вернуться в группу
+var ErrBanned = errors.New("you are banned from this chat")
+
+// checkNotBanned проверяет, что пользователь не заблокирован в чате.
+// Вызывается в транзакции вступления, чтобы проверка и вступление
+// видели одно состояние.
+func checkNotBanned(q sqlx.Queryer, chatID, userID int) error {
+	var banned bool
+	err := sqlx.Get(q, &banned, "SELECT EXISTS (SELECT 1 FROM chat_bans WHERE chat_id=$1 AND user_id=$2)",
+		chatID, userID)
+	if err != nil {
+		return err
+	}
+	if banned {
+		return ErrBanned
+	}
+	return nil
+}
+
+// checkModerate проверяет, что пользователь может блокировать и ограничивать
+// участника: нужно право ban_users, владельца трогать нельзя,
+// администраторов — только владельцу
+func checkModerate(chatID, userID, targetID int) (*memberRights, error) {
+	if userID == targetID {
+		return nil, errors.New("cannot apply this to yourself")
+	}
+	if err := checkGroup(chatID); err != nil {
+		return nil, err
+	}
+	rights, err := checkPermission(chatID, userID, PermBanUsers)
+	if err != nil {
+		return nil, err
+	}
+	target, err := getMemberRights(chatID, targetID)
+	if err == ErrNotMember {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if target.Role == RoleOwner {
+		return nil, errors.New("cannot ban or restrict the owner")
+	}
+	if target.Role == RoleAdmin && rights.Role != RoleOwner {
+		return nil, errors.New("only the owner can ban or restrict admins")
+	}
+	return target, nil
+}
+
+// BanMember блокирует пользователя в группе: он исключается, его заявки
+// на вступление отклоняются, а вернуться он сможет только после разблокировки.
+// Заблокировать можно и того, кто уже вышел из группы.
+func BanMember(chatID, userID, targetID int) error {
+	target, err := checkModerate(chatID, userID, targetID)
+	if err != nil {
+		return err
+	}
+	var exists bool
+	if err := db.DB.Get(&exists, "SELECT EXISTS (SELECT 1 FROM users WHERE id=$1)", targetID); err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("user not found")
+	}
+	c, err := beginChange()
+	if err != nil {
+		return err
+	}
+	defer c.Rollback()
+	result, err := c.Exec(`
+		INSERT INTO chat_bans (chat_id, user_id, banned_by) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`, chatID, targetID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("user is already banned")
+	}
+	_, err = c.Exec("DELETE FROM chat_join_requests WHERE chat_id=$1 AND user_id=$2", chatID, targetID)
+	if err != nil {
+		return err
+	}
+	if target != nil {
+		text, err := describeAction(chatID, userID, "banned", targetID)
+		if err != nil {
+			return err
+		}
+		err = removeMember(c, chatID, userID, targetID,
+			models.MessageAction{Type: ActionMemberBanned, UserIDs: []int{targetID}}, text)
+		if err != nil {
+			return err
+		}
+	}
+	return c.commit()
+}
+
+// UnbanMember снимает блокировку; в группу пользователь не возвращается
+func UnbanMember(chatID, userID, targetID int) error {
+	if err := checkGroup(chatID); err != nil {
+		return err
+	}
+	if _, err := checkPermission(chatID, userID, PermBanUsers); err != nil {
+		return err
+	}
+	c, err := beginChange()
+	if err != nil {
+		return err
+	}
+	defer c.Rollback()
+	result, err := c.Exec("DELETE FROM chat_bans WHERE chat_id=$1 AND user_id=$2", chatID, targetID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("user is not banned")
+	}
+	err = c.notifyUsers([]int{targetID}, realtime.Event{Type: realtime.EventMembersChanged, ChatID: chatID,
+		Data: membersChanged{Action: membersUnbanned, UserIDs: []int{targetID}}})
+	if err != nil {
+		return err
+	}
+	return c.commit()
+}
+
+// GetBannedUsers возвращает заблокированных в группе; нужно право ban_users
+func GetBannedUsers(chatID, userID int) ([]models.BannedUser, error) {
+	if _, err := checkPermission(chatID, userID, PermBanUsers); err != nil {
+		return nil, err
+	}
+	var banned []models.BannedUser
+	err := db.DB.Select(&banned, `
+		SELECT b.user_id, u.username, b.banned_by, b.created_at
+		FROM chat_bans b
+		JOIN users u ON u.id = b.user_id
+		WHERE b.chat_id = $1
+		ORDER BY b.created_at DESC
+	`, chatID)
+	return banned, err
+}
+
+// RestrictMember оставляет участнику только чтение группы на заданное время;
+// нулевая длительность снимает ограничение досрочно
+func RestrictMember(chatID, userID, targetID int, duration time.Duration) error {
+	if duration < 0 {
+		return errors.New("invalid restriction duration")
+	}
+	target, err := checkModerate(chatID, userID, targetID)
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		return ErrNotMember
+	}
+	if target.Role != RoleMember {
+		return errors.New("demote the admin before restricting")
+	}
+	var seconds *float64
+	if duration > 0 {
+		s := duration.Seconds()
+		seconds = &s
+	}
+	c, err := beginChange()
+	if err != nil {
+		return err
+	}
+	defer c.Rollback()
+	_, err = c.Exec(`
+		UPDATE chat_members SET restricted_until = now() + $1::float8 * interval '1 second'
+		WHERE chat_id = $2 AND user_id = $3
+	`, seconds, chatID, targetID)
+	if err != nil {
+		return err
+	}
+	// Подписчики канала не видят друг друга: об ограничении узнает только он сам
+	ev := realtime.Event{Type: realtime.EventMembersChanged, ChatID: chatID,
+		Data: membersChanged{Action: membersRestricted, UserIDs: []int{targetID}}}
+	if isChannel(chatID) {
+		err = c.notifyUsers([]int{targetID}, ev)
+	} else {
+		err = c.notifyChat(chatID, ev)
+	}
+	if err != nil {
+		return err
+	}
+	return c.commit()
+}
+
+// restrictedError описывает действующее ограничение участника
+func restrictedError(until time.Time) error {
+	return fmt.Errorf("you cannot send messages in this chat until %s", until.UTC().Format(time.RFC3339))
+}
@@ -0,0 +1,187 @@
+package chat
+
+import (
+	"errors"
+	"time"
+	"messenger/internal/db"
+	"messenger/internal/models"
+	"messenger/internal/realtime"
+	"messenger/internal/updates"
+	"messenger/internal/user"
+
+	"github.com/lib/pq"
+)
+
+// chatType возвращает тип чата
+func chatType(chatID int) (string, error) {
+	var t string
+	if err := db.DB.Get(&t, "SELECT type FROM chats WHERE id=$1", chatID); err != nil {
+		return "", errors.New("chat not found")
+	}
+	return t, nil
+}
+
+// isChannel проверяет, является ли чат каналом
+func isChannel(chatID int) bool {
+	t, err := chatType(chatID)
+	return err == nil && t == ChatTypeChannel
+}
+
+// CreateChannel создает канал. Публичный канал (по умолчанию) получает
+// имя, по которому в него может вступить любой; приватный — только по ссылке.
+func CreateChannel(name, username string, creatorID int, private bool) (*models.Chat, error) {
+	if name == "" {
+		return nil, errors.New("channel name is required")
+	}
+	var publicName *string
+	if !private {
+		if !usernamePattern.MatchString(username) {
+			return nil, errors.New("invalid username")
+		}
+		publicName = &username
+	}
+	chat := &models.Chat{Name: name, Type: ChatTypeChannel, IsGroup: true, Username: publicName}
+	c, err := beginChange()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Rollback()
+	err = c.QueryRow(`
+		INSERT INTO chats (name, type, is_group, username) VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, chat.Name, chat.Type, chat.IsGroup, chat.Username).Scan(&chat.ID, &chat.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if publicName != nil {
+		if err := user.ClaimUsername(c.Tx, username, 0, chat.ID); err != nil {
+			return nil, err
+		}
+	}
+	_, err = c.Exec("INSERT INTO chat_members (chat_id, user_id, role) VALUES ($1, $2, $3)",
+		chat.ID, creatorID, RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	// Создатель пока единственный подписчик, событие идет в его журнал
+	err = c.notifyUsers([]int{creatorID}, realtime.Event{Type: realtime.EventChatCreated, ChatID: chat.ID, Data: chat})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.commit(); err != nil {
+		return nil, err
+	}
+	return chat, nil
+}
+
+// checkCanPost проверяет, что пользователь может писать в чат. Участник
+// с действующим ограничением только читает. В каналах пишут только владелец
+// и администраторы, а посты подписываются каналом: возвращается ID
+// чата-автора или nil для обычных сообщений.
+func checkCanPost(chatID, userID int) (*int, error) {
+	var row struct {
+		Type            string     `db:"type"`
+		Role            string     `db:"role"`
+		RestrictedUntil *time.Time `db:"restricted_until"`
+	}
+	err := db.DB.Get(&row, `
+		SELECT c.type, cm.role,
+			CASE WHEN cm.restricted_until > now() THEN cm.restricted_until END AS restricted_until
+		FROM chats c
+		JOIN chat_members cm ON cm.chat_id = c.id AND cm.user_id = $2
+		WHERE c.id = $1
+	`, chatID, userID)
+	if err != nil {
+		return nil, ErrNotMember
+	}
+	if row.RestrictedUntil != nil {
+		return nil, restrictedError(*row.RestrictedUntil)
+	}
+	if row.Type != ChatTypeChannel {
+		return nil, nil
+	}
+	if row.Role == RoleMember {
+		return nil, errors.New("only admins can post in this channel")
+	}
+	return &chatID, nil
+}
+
+// countViews засчитывает пользователю просмотр постов каналов
+// и обновляет счетчики в переданных сообщениях
+func countViews(userID int, messages []*models.Message) error {
+	var ids []int64
+	byID := make(map[int]*models.Message)
+	for _, m := range messages {
+		if m.SenderChatID != nil && m.Action == nil {
+			ids = append(ids, int64(m.ID))
+			byID[m.ID] = m
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	// Счетчик растет только для тех, кто смотрит пост впервые
+	var counted []struct {
+		ID        int `db:"id"`
+		ViewCount int `db:"view_count"`
+	}
+	err := db.DB.Select(&counted, `
+		WITH viewed AS (
+			INSERT INTO message_views (message_id, user_id)
+			SELECT unnest($1::int[]), $2
+			ON CONFLICT DO NOTHING
+			RETURNING message_id
+		)
+		UPDATE messages SET view_count = view_count + 1
+		WHERE id IN (SELECT message_id FROM viewed)
+		RETURNING id, view_count
+	`, pq.Array(ids), userID)
+	if err != nil {
+		return err
+	}
+	for _, c := range counted {
+		byID[c.ID].ViewCount = c.ViewCount
+	}
+	return nil
+}
+
+// ViewMessages отмечает просмотр постов канала, пришедших в реальном времени,
+// и возвращает их актуальные счетчики
+func ViewMessages(chatID, userID int, messageIDs []int) (map[int]int, error) {
+	if len(messageIDs) > MaxMessagesLimit {
+		return nil, errors.New("too many messages")
+	}
+	if err := checkMember(chatID, userID); err != nil {
+		return nil, err
+	}
+	ids := make([]int64, len(messageIDs))
+	for i, id := range messageIDs {
+		ids[i] = int64(id)
+	}
+	var messages []models.Message
+	err := db.DB.Select(&messages, "SELECT * FROM messages WHERE chat_id = $1 AND id = ANY($2)",
+		chatID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	if err := countViews(userID, messagePointers(messages)); err != nil {
+		return nil, err
+	}
+	views := make(map[int]int, len(messages))
+	for _, m := range messages {
+		views[m.ID] = m.ViewCount
+	}
+	return views, nil
+}
+
+// GetChannelDifference возвращает записи журнала канала после since.
+// Журнал доступен только подписчикам канала.
+func GetChannelDifference(chatID, userID int, since int64) (*updates.Difference, error) {
+	if err := checkMember(chatID, userID); err != nil {
+		return nil, err
+	}
+	if !isChannel(chatID) {
+		return nil, errors.New("chat is not a channel")
+	}
+	return updates.GetChannelDifference(chatID, since)
+}
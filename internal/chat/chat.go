@@ -2,8 +2,17 @@ package chat
 
 import (
 	"errors"
+	"time"
 	"messenger/internal/db"
 	"messenger/internal/models"
+	"messenger/internal/realtime"
+)
+
+// Типы чатов
+const (
+	ChatTypePrivate = "private"
+	ChatTypeGroup   = "group"
+	ChatTypeChannel = "channel" // пишут администраторы, остальные читают
 )
 
 // CreatePrivateChat создает личный чат между двумя пользователями
@@ -21,21 +30,32 @@ func CreatePrivateChat(userID1, userID2 int) (*models.Chat, error) {
 		return &existingChat, nil // Чат уже существует
 	}
 	// Создаем новый чат
-	var chatID int
-	err = db.DB.QueryRow(
-		"INSERT INTO chats (name, is_group) VALUES ($1, $2) RETURNING id",
-		"", false,
-	).Scan(&chatID)
+	c, err := beginChange()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Rollback()
+	chat := &models.Chat{Name: "", Type: ChatTypePrivate, IsGroup: false}
+	err = c.QueryRow(
+		"INSERT INTO chats (name, type, is_group) VALUES ($1, $2, $3) RETURNING id, created_at",
+		chat.Name, chat.Type, chat.IsGroup,
+	).Scan(&chat.ID, &chat.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 	// Добавляем участников
-	_, err = db.DB.Exec("INSERT INTO chat_members (chat_id, user_id) VALUES ($1, $2), ($1, $3)",
-		chatID, userID1, userID2)
+	_, err = c.Exec("INSERT INTO chat_members (chat_id, user_id) VALUES ($1, $2), ($1, $3)",
+		chat.ID, userID1, userID2)
 	if err != nil {
 		return nil, err
 	}
-	return &models.Chat{ID: chatID, Name: "", IsGroup: false}, nil
+	if err := c.notifyChat(chat.ID, realtime.Event{Type: realtime.EventChatCreated, Data: chat}); err != nil {
+		return nil, err
+	}
+	if err := c.commit(); err != nil {
+		return nil, err
+	}
+	return chat, nil
 }
 
 // CreateGroupChat создает групповой чат
@@ -44,34 +64,144 @@ func CreateGroupChat(name string, creatorID int, memberIDs []int) (*models.Chat,
 		return nil, errors.New("group name is required")
 	}
 	// Создаем чат
-	var chatID int
-	err := db.DB.QueryRow(
-		"INSERT INTO chats (name, is_group) VALUES ($1, $2) RETURNING id",
-		name, true,
-	).Scan(&chatID)
+	c, err := beginChange()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Rollback()
+	chat := &models.Chat{Name: name, Type: ChatTypeGroup, IsGroup: true}
+	err = c.QueryRow(
+		"INSERT INTO chats (name, type, is_group) VALUES ($1, $2, $3) RETURNING id, created_at",
+		chat.Name, chat.Type, chat.IsGroup,
+	).Scan(&chat.ID, &chat.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	// Добавляем создателя (владельцем) и участников
+	_, err = c.Exec("INSERT INTO chat_members (chat_id, user_id, role) VALUES ($1, $2, $3)",
+		chat.ID, creatorID, RoleOwner)
 	if err != nil {
 		return nil, err
 	}
-	// Добавляем создателя и участников
-	memberIDs = append([]int{creatorID}, memberIDs...)
 	for _, memberID := range memberIDs {
-		_, err = db.DB.Exec("INSERT INTO chat_members (chat_id, user_id) VALUES ($1, $2)",
-			chatID, memberID)
+		if memberID == creatorID {
+			continue
+		}
+		_, err = c.Exec("INSERT INTO chat_members (chat_id, user_id) VALUES ($1, $2)",
+			chat.ID, memberID)
 		if err != nil {
 			return nil, err
 		}
 	}
-	return &models.Chat{ID: chatID, Name: name, IsGroup: true}, nil
+	if err := c.notifyChat(chat.ID, realtime.Event{Type: realtime.EventChatCreated, Data: chat}); err != nil {
+		return nil, err
+	}
+	if err := c.commit(); err != nil {
+		return nil, err
+	}
+	return chat, nil
 }
 
-// GetUserChats получает все чаты пользователя
-func GetUserChats(userID int) ([]models.Chat, error) {
-	var chats []models.Chat
-	err := db.DB.Select(&chats, `
-		SELECT c.* FROM chats c
+// MaxChatsLimit — верхняя граница количества чатов за один запрос
+const MaxChatsLimit = 100
+
+// ChatsPage — страница списка чатов, от недавно активных к давним
+type ChatsPage struct {
+	Chats      []models.ChatListItem
+	NextOffset int // смещение следующей страницы; 0 — чатов больше нет
+}
+
+// chatListRow — строка списка чатов; последнее сообщение и собеседник
+// приходят плоскими колонками и могут отсутствовать
+type chatListRow struct {
+	models.ChatListItem
+	LastMessageID       *int       `db:"last_message_id"`
+	LastMessageSenderID *int       `db:"last_message_sender_id"`
+	LastMessageText     *string    `db:"last_message_text"`
+	LastMessageSentAt   *time.Time `db:"last_message_sent_at"`
+	PeerID              *int       `db:"peer_id"`
+	PeerUsername        *string    `db:"peer_username"`
+}
+
+// GetUserChats получает страницу чатов пользователя, отсортированных по последней
+// активности, с последним сообщением, собеседником, числом участников
+// и непрочитанных сообщений. Все собирается одним запросом.
+func GetUserChats(userID, offset, limit int) (*ChatsPage, error) {
+	if offset < 0 {
+		return nil, errors.New("invalid offset")
+	}
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > MaxChatsLimit {
+		limit = MaxChatsLimit
+	}
+	var rows []chatListRow
+	err := db.DB.Select(&rows, `
+		SELECT c.*, cm.last_read_message_id,
+			(
+				SELECT COUNT(*) FROM messages m
+				WHERE m.chat_id = c.id AND m.id > cm.last_read_message_id
+				AND m.sender_id <> $1 AND m.deleted_at IS NULL AND m.thread_root_id IS NULL
+				AND NOT EXISTS (
+					SELECT 1 FROM message_hidden h
+					WHERE h.message_id = m.id AND h.user_id = $1
+				)
+			) AS unread_count,
+			(SELECT COUNT(*) FROM chat_members mc WHERE mc.chat_id = c.id) AS member_count,
+			lm.id AS last_message_id,
+			CASE WHEN lm.sender_chat_id IS NULL THEN COALESCE(lm.sender_id, 0) ELSE 0 END AS last_message_sender_id,
+			COALESCE(LEFT(lm.text, $2), '') AS last_message_text, lm.sent_at AS last_message_sent_at,
+			COALESCE(lm.sent_at, c.created_at) AS last_activity_at,
+			peer.id AS peer_id, peer.username AS peer_username,
+			CASE WHEN peer.show_read_receipts AND u.show_read_receipts
+				THEN peer.last_read_message_id END AS peer_last_read_message_id
+		FROM chats c
 		JOIN chat_members cm ON c.id = cm.chat_id
+		JOIN users u ON u.id = cm.user_id
+		LEFT JOIN LATERAL (
+			SELECT m.id, m.sender_id, m.sender_chat_id, m.text, m.sent_at FROM messages m
+			WHERE m.chat_id = c.id AND m.deleted_at IS NULL AND m.thread_root_id IS NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM message_hidden h
+				WHERE h.message_id = m.id AND h.user_id = $1
+			)
+			ORDER BY m.id DESC
+			LIMIT 1
+		) lm ON true
+		LEFT JOIN LATERAL (
+			SELECT pu.id, pu.username, pu.show_read_receipts, pm.last_read_message_id
+			FROM chat_members pm
+			JOIN users pu ON pu.id = pm.user_id
+			WHERE pm.chat_id = c.id AND pm.user_id <> $1 AND NOT c.is_group
+			LIMIT 1
+		) peer ON true
 		WHERE cm.user_id = $1
-		ORDER BY c.id DESC
-	`, userID)
-	return chats, err
+		ORDER BY last_activity_at DESC, c.id DESC
+		LIMIT $3 OFFSET $4
+	`, userID, ReplyPreviewLength, limit+1, offset)
+	if err != nil {
+		return nil, err
+	}
+	page := &ChatsPage{Chats: make([]models.ChatListItem, 0, len(rows))}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		page.NextOffset = offset + limit
+	}
+	for _, row := range rows {
+		item := row.ChatListItem
+		if row.LastMessageID != nil {
+			item.LastMessage = &models.ChatLastMessage{
+				ID:       *row.LastMessageID,
+				SenderID: *row.LastMessageSenderID,
+				Text:     *row.LastMessageText,
+				SentAt:   *row.LastMessageSentAt,
+			}
+		}
+		if row.PeerID != nil {
+			item.Peer = &models.User{ID: *row.PeerID, Username: *row.PeerUsername}
+		}
+		page.Chats = append(page.Chats, item)
+	}
+	return page, nil
 }
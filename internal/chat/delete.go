@@ -0,0 +1,146 @@
+package chat
+
+import (
+	"errors"
+	"time"
+	"messenger/internal/db"
+	"messenger/internal/realtime"
+)
+
+// DeleteWindow — сколько времени после отправки отправитель может удалить
+// сообщение для всех. Администраторы группы могут удалять в любое время.
+// Ноль отключает ограничение.
+var DeleteWindow = 48 * time.Hour
+
+// messageDeleted — данные события об удалении сообщения
+type messageDeleted struct {
+	MessageID   int  `json:"message_id"`
+	ForEveryone bool `json:"for_everyone"`
+}
+
+// DeleteMessageForMe скрывает сообщение только для пользователя
+func DeleteMessageForMe(messageID, userID int) error {
+	message, err := getMessage(db.DB, messageID)
+	if err != nil {
+		return err
+	}
+	if err := checkMember(message.ChatID, userID); err != nil {
+		return err
+	}
+	c, err := beginChange()
+	if err != nil {
+		return err
+	}
+	defer c.Rollback()
+	_, err = c.Exec(`
+		INSERT INTO message_hidden (message_id, user_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, messageID, userID)
+	if err != nil {
+		return err
+	}
+	// Остальные устройства пользователя тоже должны убрать сообщение
+	err = c.notifyUsers([]int{userID}, realtime.Event{
+		Type:   realtime.EventMessageDeleted,
+		ChatID: message.ChatID,
+		Data:   messageDeleted{MessageID: messageID},
+	})
+	if err != nil {
+		return err
+	}
+	return c.commit()
+}
+
+// DeleteMessageForEveryone удаляет сообщение у всех участников чата.
+// Текст, история правок и реакции стираются, в чате остается пустая запись.
+// Вложения, которые больше нигде не используются, удаляются из хранилища,
+// а счетчики ветки пересчитываются.
+func DeleteMessageForEveryone(messageID, userID int) error {
+	message, err := getMessage(db.DB, messageID)
+	if err != nil {
+		return err
+	}
+	rights, err := getMemberRights(message.ChatID, userID)
+	if err != nil {
+		return err
+	}
+	if message.DeletedAt != nil {
+		return nil
+	}
+	// Администраторы с правом удаления удаляют любые сообщения без ограничения по времени
+	if !rights.can(PermDeleteMessages) {
+		if message.SenderID != userID {
+			return errors.New("only the sender or a group admin can delete this message")
+		}
+		if DeleteWindow > 0 {
+			age, err := messageAge(messageID)
+			if err != nil {
+				return err
+			}
+			if age > DeleteWindow {
+				return errors.New("message can no longer be deleted for everyone")
+			}
+		}
+	}
+	c, err := beginChange()
+	if err != nil {
+		return err
+	}
+	defer c.Rollback()
+	_, err = c.Exec("UPDATE messages SET text='', deleted_at=now() WHERE id=$1", messageID)
+	if err != nil {
+		return err
+	}
+	_, err = c.Exec("DELETE FROM message_edits WHERE message_id=$1", messageID)
+	if err != nil {
+		return err
+	}
+	_, err = c.Exec("DELETE FROM message_reactions WHERE message_id=$1", messageID)
+	if err != nil {
+		return err
+	}
+	var attachmentIDs []int64
+	err = c.Select(&attachmentIDs, "DELETE FROM message_attachments WHERE message_id=$1 RETURNING attachment_id",
+		messageID)
+	if err != nil {
+		return err
+	}
+	// Пересланные копии ссылаются на те же вложения, их содержимое остается
+	files, err := deleteUnusedAttachments(c.Tx, attachmentIDs)
+	if err != nil {
+		return err
+	}
+	var thread *threadUpdated
+	if message.ThreadRootID != nil {
+		if thread, err = removeThreadReply(c.Tx, *message.ThreadRootID); err != nil {
+			return err
+		}
+	}
+	// Удаленное сообщение перестает быть закрепленным
+	unpinned, err := c.Exec("DELETE FROM pinned_messages WHERE message_id=$1", messageID)
+	if err != nil {
+		return err
+	}
+	err = c.notifyChat(message.ChatID, realtime.Event{
+		Type: realtime.EventMessageDeleted,
+		Data: messageDeleted{MessageID: messageID, ForEveryone: true},
+	})
+	if err != nil {
+		return err
+	}
+	if n, _ := unpinned.RowsAffected(); n > 0 {
+		if err := notifyPinsUpdated(c, message.ChatID); err != nil {
+			return err
+		}
+	}
+	if thread != nil {
+		if err := notifyThreadUpdated(c, message.ChatID, thread); err != nil {
+			return err
+		}
+	}
+	if err := c.commit(); err != nil {
+		return err
+	}
+	deleteFiles(files)
+	return nil
+}
@@ -0,0 +1,119 @@
+package chat
+
+import (
+	"errors"
+	"time"
+	"messenger/internal/db"
+	"messenger/internal/models"
+	"messenger/internal/realtime"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// EditWindow — сколько времени после отправки сообщение можно редактировать.
+// Ноль отключает ограничение.
+var EditWindow = 48 * time.Hour
+
+// getMessage получает сообщение по ID
+func getMessage(q sqlx.Queryer, messageID int) (*models.Message, error) {
+	var message models.Message
+	err := sqlx.Get(q, &message, "SELECT * FROM messages WHERE id=$1", messageID)
+	if err != nil {
+		return nil, errors.New("message not found")
+	}
+	return &message, nil
+}
+
+// messageAge возвращает, сколько времени прошло с отправки сообщения.
+// Считается в базе, чтобы не зависеть от часового пояса сервера.
+func messageAge(messageID int) (time.Duration, error) {
+	var seconds float64
+	err := db.DB.Get(&seconds, "SELECT EXTRACT(EPOCH FROM now() - sent_at) FROM messages WHERE id=$1", messageID)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// EditMessage изменяет текст сообщения. Редактировать может только отправитель,
+// предыдущая версия сохраняется в истории правок.
+func EditMessage(messageID, userID int, text string) (*models.Message, error) {
+	if text == "" {
+		return nil, errors.New("message text cannot be empty")
+	}
+	message, err := getMessage(db.DB, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.DeletedAt != nil {
+		return nil, errors.New("message was deleted")
+	}
+	if message.Action != nil {
+		return nil, errors.New("service messages cannot be edited")
+	}
+	if message.SenderID != userID {
+		return nil, errors.New("only the sender can edit this message")
+	}
+	// Участник с ограничением только читает и править свои сообщения не может
+	if _, err := checkCanPost(message.ChatID, userID); err != nil {
+		return nil, err
+	}
+	if EditWindow > 0 {
+		age, err := messageAge(messageID)
+		if err != nil {
+			return nil, err
+		}
+		if age > EditWindow {
+			return nil, errors.New("message can no longer be edited")
+		}
+	}
+	if message.Text == text {
+		return message, nil
+	}
+	// Сохраняем предыдущую версию и обновляем сообщение в одной транзакции
+	c, err := beginChange()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Rollback()
+	_, err = c.Exec("INSERT INTO message_edits (message_id, text) VALUES ($1, $2)",
+		messageID, message.Text)
+	if err != nil {
+		return nil, err
+	}
+	var edited models.Message
+	err = c.Get(&edited, "UPDATE messages SET text=$1, edited_at=now() WHERE id=$2 RETURNING *",
+		text, messageID)
+	if err != nil {
+		return nil, err
+	}
+	// Событие получат все участники, поэтому реакции без отметки пользователя
+	if err := decorateMessages(c, []*models.Message{&edited}, 0); err != nil {
+		return nil, err
+	}
+	if err := c.notifyChat(edited.ChatID, realtime.Event{Type: realtime.EventMessageEdited, Data: &edited}); err != nil {
+		return nil, err
+	}
+	if err := c.commit(); err != nil {
+		return nil, err
+	}
+	return &edited, nil
+}
+
+// GetMessageEdits получает историю правок сообщения, от старых версий к новым
+func GetMessageEdits(messageID, userID int) ([]models.MessageEdit, error) {
+	message, err := getMessage(db.DB, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMember(message.ChatID, userID); err != nil {
+		return nil, err
+	}
+	edits := []models.MessageEdit{}
+	err = db.DB.Select(&edits, `
+		SELECT * FROM message_edits
+		WHERE message_id = $1
+		ORDER BY id
+	`, messageID)
+	return edits, err
+}
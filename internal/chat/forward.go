@@ -0,0 +1,108 @@
+package chat
+
+import (
+	"errors"
+	"sort"
+	"messenger/internal/db"
+	"messenger/internal/models"
+	"messenger/internal/realtime"
+
+	"github.com/lib/pq"
+)
+
+// MaxForwardMessages — сколько сообщений можно переслать за один раз
+const MaxForwardMessages = 100
+
+// ForwardMessages пересылает сообщения из одного чата в другой. Копии сохраняют
+// автора, чат и время оригинала и идут в том же порядке, что и оригиналы.
+func ForwardMessages(fromChatID int, messageIDs []int, toChatID, userID int) ([]models.Message, error) {
+	if len(messageIDs) == 0 {
+		return nil, errors.New("no messages to forward")
+	}
+	if len(messageIDs) > MaxForwardMessages {
+		return nil, errors.New("too many messages to forward")
+	}
+	// Пользователь должен состоять в обоих чатах
+	if err := checkMember(fromChatID, userID); err != nil {
+		return nil, err
+	}
+	senderChatID, err := checkCanPost(toChatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, len(messageIDs))
+	for i, id := range messageIDs {
+		ids[i] = int64(id)
+	}
+	var sources []models.Message
+	err = db.DB.Select(&sources, `
+		SELECT * FROM messages
+		WHERE chat_id = $1 AND id = ANY($2) AND deleted_at IS NULL AND action IS NULL
+		AND NOT EXISTS (
+			SELECT 1 FROM message_hidden h
+			WHERE h.message_id = messages.id AND h.user_id = $3
+		)
+	`, fromChatID, pq.Array(ids), userID)
+	if err != nil {
+		return nil, err
+	}
+	unique := make(map[int]struct{}, len(messageIDs))
+	for _, id := range messageIDs {
+		unique[id] = struct{}{}
+	}
+	if len(sources) != len(unique) {
+		return nil, errors.New("some messages were not found in the source chat")
+	}
+	// Сохраняем хронологический порядок оригиналов
+	sort.Slice(sources, func(i, j int) bool { return sources[i].ID < sources[j].ID })
+
+	c, err := beginChange()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Rollback()
+	forwarded := make([]models.Message, 0, len(sources))
+	for _, src := range sources {
+		// У постов каналов автор — сам канал. При повторной пересылке
+		// указываем первоисточник.
+		fromUserID, fromChatID, sentAt := &src.SenderID, src.ChatID, src.SentAt
+		if src.SenderChatID != nil {
+			fromUserID = nil
+		}
+		if src.ForwardedFromChatID != nil {
+			fromUserID = src.ForwardedFromUserID
+			fromChatID = *src.ForwardedFromChatID
+			sentAt = *src.ForwardedFromSentAt
+		}
+		var message models.Message
+		err = c.Get(&message, `
+			INSERT INTO messages (chat_id, sender_id, sender_chat_id, text,
+				forwarded_from_user_id, forwarded_from_chat_id, forwarded_from_sent_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING *
+		`, toChatID, userID, senderChatID, src.Text, fromUserID, fromChatID, sentAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := copyAttachments(c.Tx, src.ID, message.ID); err != nil {
+			return nil, err
+		}
+		forwarded = append(forwarded, message)
+	}
+	if err := decorateMessages(c, messagePointers(forwarded), userID); err != nil {
+		return nil, err
+	}
+	for i := range forwarded {
+		if err := c.notifyChat(toChatID, realtime.Event{Type: realtime.EventNewMessage, Data: &forwarded[i]}); err != nil {
+			return nil, err
+		}
+	}
+	if err := takeSendRate(c.Tx, toChatID, userID, len(sources)); err != nil {
+		return nil, err
+	}
+	if err := c.commit(); err != nil {
+		refundMessageTokens(userID, len(sources))
+		return nil, err
+	}
+	return forwarded, nil
+}
@@ -0,0 +1,157 @@
+package chat
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+	"messenger/internal/db"
+	"messenger/internal/models"
+	"messenger/internal/realtime"
+)
+
+// Ограничения на оформление группы
+const (
+	MaxTitleLength       = 128
+	MaxDescriptionLength = 255
+)
+
+// ChatInfoUpdate — изменяемые поля группы; nil — поле не меняется
+type ChatInfoUpdate struct {
+	Title       *string
+	Description *string
+	AvatarURL   *string // пустая строка удаляет фото
+}
+
+// getChat получает чат по ID
+func getChat(chatID int) (*models.Chat, error) {
+	var chat models.Chat
+	if err := db.DB.Get(&chat, "SELECT * FROM chats WHERE id=$1", chatID); err != nil {
+		return nil, errors.New("chat not found")
+	}
+	return &chat, nil
+}
+
+// GetChatInfo получает сведения о чате вместе с ролью и правами запросившего
+func GetChatInfo(chatID, userID int) (*models.ChatInfo, error) {
+	var info models.ChatInfo
+	err := db.DB.Get(&info, `
+		SELECT c.*, cm.role, cm.permissions,
+			CASE WHEN cm.restricted_until > now() THEN cm.restricted_until END AS restricted_until,
+			ARRAY(SELECT p.message_id FROM pinned_messages p WHERE p.chat_id = c.id
+				ORDER BY p.pinned_at DESC, p.message_id DESC) AS pinned_message_ids,
+			(SELECT COUNT(*) FROM chat_members mc WHERE mc.chat_id = c.id) AS member_count
+		FROM chats c
+		JOIN chat_members cm ON cm.chat_id = c.id AND cm.user_id = $2
+		WHERE c.id = $1
+	`, chatID, userID)
+	if err != nil {
+		return nil, ErrNotMember
+	}
+	return &info, nil
+}
+
+// UpdateChatInfo меняет название, описание или фото группы. Нужно право
+// change_info; о каждом изменении в чат пишется служебное сообщение.
+func UpdateChatInfo(chatID, userID int, update ChatInfoUpdate) (*models.Chat, error) {
+	if update.Title != nil {
+		title := strings.TrimSpace(*update.Title)
+		if title == "" {
+			return nil, errors.New("group name is required")
+		}
+		if utf8.RuneCountInString(title) > MaxTitleLength {
+			return nil, errors.New("group name is too long")
+		}
+		update.Title = &title
+	}
+	if update.Description != nil && utf8.RuneCountInString(*update.Description) > MaxDescriptionLength {
+		return nil, errors.New("description is too long")
+	}
+	if update.AvatarURL != nil && *update.AvatarURL != "" {
+		if !validAvatarURL(*update.AvatarURL) {
+			return nil, errors.New("invalid avatar url")
+		}
+	}
+	if err := checkGroup(chatID); err != nil {
+		return nil, err
+	}
+	if _, err := checkPermission(chatID, userID, PermChangeInfo); err != nil {
+		return nil, err
+	}
+	chat, err := getChat(chatID)
+	if err != nil {
+		return nil, err
+	}
+	// Служебные сообщения только о действительно измененных полях
+	noun := "group"
+	if chat.Type == ChatTypeChannel {
+		noun = "channel"
+	}
+	type infoChange struct {
+		action models.MessageAction
+		verb   string
+	}
+	var changes []infoChange
+	if update.Title != nil && *update.Title != chat.Name {
+		chat.Name = *update.Title
+		changes = append(changes, infoChange{
+			models.MessageAction{Type: ActionTitleChanged, Title: chat.Name},
+			`changed the ` + noun + ` name to "` + chat.Name + `"`,
+		})
+	}
+	if update.Description != nil && *update.Description != chat.Description {
+		chat.Description = *update.Description
+		changes = append(changes, infoChange{
+			models.MessageAction{Type: ActionDescriptionChanged}, "changed the " + noun + " description",
+		})
+	}
+	if update.AvatarURL != nil && *update.AvatarURL != chat.AvatarURL {
+		chat.AvatarURL = *update.AvatarURL
+		if chat.AvatarURL == "" {
+			changes = append(changes, infoChange{models.MessageAction{Type: ActionPhotoRemoved}, "removed the " + noun + " photo"})
+		} else {
+			changes = append(changes, infoChange{models.MessageAction{Type: ActionPhotoChanged}, "changed the " + noun + " photo"})
+		}
+	}
+	if len(changes) == 0 {
+		return chat, nil
+	}
+	c, err := beginChange()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Rollback()
+	_, err = c.Exec("UPDATE chats SET name=$1, description=$2, avatar_url=$3 WHERE id=$4",
+		chat.Name, chat.Description, chat.AvatarURL, chatID)
+	if err != nil {
+		return nil, err
+	}
+	for _, ch := range changes {
+		text, err := describeAction(chatID, userID, ch.verb)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := sendServiceMessage(c, chatID, userID, ch.action, text); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.notifyChat(chatID, realtime.Event{Type: realtime.EventChatUpdated, Data: chat}); err != nil {
+		return nil, err
+	}
+	if err := c.commit(); err != nil {
+		return nil, err
+	}
+	return chat, nil
+}
+
+// validAvatarURL допускает внешние http(s)-ссылки и пути на этом сервере
+func validAvatarURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "" {
+		return u.Host == "" && strings.HasPrefix(u.Path, "/")
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,325 @@
+package chat
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+	"messenger/internal/db"
+	"messenger/internal/models"
+	"messenger/internal/realtime"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrInvalidInvite возвращается для несуществующей, отозванной или истекшей ссылки
+var ErrInvalidInvite = errors.New("invite link is invalid or expired")
+
+// InviteLinkOptions — ограничения новой ссылки-приглашения
+type InviteLinkOptions struct {
+	ExpireIn         time.Duration // 0 — бессрочная
+	MaxUses          int           // 0 — без ограничения
+	RequiresApproval bool          // вступление только после одобрения администратором
+}
+
+// JoinResult — итог перехода по ссылке-приглашению
+type JoinResult struct {
+	ChatID  int
+	Pending bool // заявка ждет одобрения
+}
+
+// joinRequested — данные события о новой заявке на вступление
+type joinRequested struct {
+	UserID int `json:"user_id"`
+}
+
+// newInviteToken возвращает случайный токен ссылки
+func newInviteToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// CreateInviteLink создает ссылку-приглашение в группу. Нужно право invite_users.
+func CreateInviteLink(chatID, userID int, opts InviteLinkOptions) (*models.InviteLink, error) {
+	if opts.ExpireIn < 0 || opts.MaxUses < 0 {
+		return nil, errors.New("invalid invite link limits")
+	}
+	if err := checkGroup(chatID); err != nil {
+		return nil, err
+	}
+	if _, err := checkPermission(chatID, userID, PermInviteUsers); err != nil {
+		return nil, err
+	}
+	token, err := newInviteToken()
+	if err != nil {
+		return nil, err
+	}
+	var expireIn *float64
+	if opts.ExpireIn > 0 {
+		seconds := opts.ExpireIn.Seconds()
+		expireIn = &seconds
+	}
+	var maxUses *int
+	if opts.MaxUses > 0 {
+		maxUses = &opts.MaxUses
+	}
+	var link models.InviteLink
+	err = db.DB.Get(&link, `
+		INSERT INTO chat_invite_links (chat_id, token, creator_id, expires_at, max_uses, requires_approval)
+		VALUES ($1, $2, $3, now() + $4::float8 * interval '1 second', $5, $6)
+		RETURNING *
+	`, chatID, token, userID, expireIn, maxUses, opts.RequiresApproval)
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// GetInviteLinks получает ссылки группы с числом использований и заявок
+func GetInviteLinks(chatID, userID int) ([]models.InviteLink, error) {
+	if _, err := checkPermission(chatID, userID, PermInviteUsers); err != nil {
+		return nil, err
+	}
+	var links []models.InviteLink
+	err := db.DB.Select(&links, `
+		SELECT l.*, (
+			SELECT COUNT(*) FROM chat_join_requests r WHERE r.link_id = l.id
+		) AS pending_requests
+		FROM chat_invite_links l
+		WHERE l.chat_id = $1
+		ORDER BY l.id DESC
+	`, chatID)
+	return links, err
+}
+
+// getInviteLink получает ссылку и проверяет право пользователя управлять ею
+func getInviteLink(linkID, userID int) (*models.InviteLink, error) {
+	var link models.InviteLink
+	if err := db.DB.Get(&link, "SELECT * FROM chat_invite_links WHERE id=$1", linkID); err != nil {
+		return nil, errors.New("invite link not found")
+	}
+	if _, err := checkPermission(link.ChatID, userID, PermInviteUsers); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// GetInviteLinkJoins получает тех, кто вступил по ссылке, от новых к старым
+func GetInviteLinkJoins(linkID, userID int) ([]models.InviteJoin, error) {
+	if _, err := getInviteLink(linkID, userID); err != nil {
+		return nil, err
+	}
+	var joins []models.InviteJoin
+	err := db.DB.Select(&joins, `
+		SELECT j.user_id, u.username, j.joined_at
+		FROM chat_invite_joins j
+		JOIN users u ON u.id = j.user_id
+		WHERE j.link_id = $1
+		ORDER BY j.joined_at DESC
+	`, linkID)
+	return joins, err
+}
+
+// RevokeInviteLink отзывает ссылку; поданные по ней заявки остаются в очереди
+func RevokeInviteLink(linkID, userID int) error {
+	if _, err := getInviteLink(linkID, userID); err != nil {
+		return err
+	}
+	_, err := db.DB.Exec("UPDATE chat_invite_links SET revoked_at=now() WHERE id=$1 AND revoked_at IS NULL", linkID)
+	return err
+}
+
+// activeInviteLink — ссылка вместе с признаком истечения, посчитанным в базе
+type activeInviteLink struct {
+	models.InviteLink
+	Expired bool `db:"expired"`
+}
+
+// usable проверяет, что по ссылке еще можно вступить
+func (l *activeInviteLink) usable() bool {
+	if l.RevokedAt != nil || l.Expired {
+		return false
+	}
+	return l.MaxUses == nil || l.Uses < *l.MaxUses
+}
+
+// GetInvitePreview показывает группу по ссылке до вступления
+func GetInvitePreview(token string) (*models.InvitePreview, error) {
+	var preview models.InvitePreview
+	err := db.DB.Get(&preview, `
+		SELECT c.id AS chat_id, c.name, c.description, c.avatar_url, l.requires_approval,
+			(SELECT COUNT(*) FROM chat_members cm WHERE cm.chat_id = c.id) AS member_count
+		FROM chat_invite_links l
+		JOIN chats c ON c.id = l.chat_id
+		WHERE l.token = $1 AND l.revoked_at IS NULL
+		AND (l.expires_at IS NULL OR l.expires_at > now())
+		AND (l.max_uses IS NULL OR l.uses < l.max_uses)
+	`, token)
+	if err != nil {
+		return nil, ErrInvalidInvite
+	}
+	return &preview, nil
+}
+
+// JoinByInviteLink вступает в группу по ссылке или, если ссылка требует
+// одобрения, ставит заявку в очередь и сообщает о ней администраторам
+func JoinByInviteLink(token string, userID int) (*JoinResult, error) {
+	c, err := beginChange()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Rollback()
+	// Блокируем ссылку, чтобы не превысить лимит при одновременных вступлениях
+	var link activeInviteLink
+	err = c.Get(&link, `
+		SELECT *, expires_at IS NOT NULL AND expires_at <= now() AS expired
+		FROM chat_invite_links WHERE token = $1 FOR UPDATE
+	`, token)
+	if err != nil || !link.usable() {
+		return nil, ErrInvalidInvite
+	}
+	if err := checkMember(link.ChatID, userID); err == nil {
+		return nil, errors.New("you are already a member of this chat")
+	}
+	if err := checkNotBanned(c, link.ChatID, userID); err != nil {
+		return nil, err
+	}
+	result := &JoinResult{ChatID: link.ChatID, Pending: link.RequiresApproval}
+	if link.RequiresApproval {
+		res, err := c.Exec(`
+			INSERT INTO chat_join_requests (chat_id, user_id, link_id) VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING
+		`, link.ChatID, userID, link.ID)
+		if err != nil {
+			return nil, err
+		}
+		// Повторная заявка уже ждет рассмотрения, администраторов не беспокоим
+		if n, _ := res.RowsAffected(); n == 1 {
+			if err := notifyJoinRequested(c, link.ChatID, userID); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		joined, err := joinViaLink(c.Tx, link.ChatID, link.ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if joined {
+			if err := announceJoin(c, link.ChatID, userID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := c.commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetJoinRequests получает заявки на вступление в группу
+func GetJoinRequests(chatID, userID int) ([]models.JoinRequest, error) {
+	if _, err := checkPermission(chatID, userID, PermInviteUsers); err != nil {
+		return nil, err
+	}
+	var requests []models.JoinRequest
+	err := db.DB.Select(&requests, `
+		SELECT r.user_id, u.username, r.link_id, r.requested_at
+		FROM chat_join_requests r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.chat_id = $1
+		ORDER BY r.requested_at
+	`, chatID)
+	return requests, err
+}
+
+// ResolveJoinRequest одобряет или отклоняет заявку на вступление. Нужно право invite_users.
+func ResolveJoinRequest(chatID, userID, requesterID int, approve bool) error {
+	if _, err := checkPermission(chatID, userID, PermInviteUsers); err != nil {
+		return err
+	}
+	c, err := beginChange()
+	if err != nil {
+		return err
+	}
+	defer c.Rollback()
+	var linkID int
+	err = c.Get(&linkID, "DELETE FROM chat_join_requests WHERE chat_id=$1 AND user_id=$2 RETURNING link_id",
+		chatID, requesterID)
+	if err == sql.ErrNoRows {
+		return errors.New("join request not found")
+	}
+	if err != nil {
+		return err
+	}
+	if !approve {
+		return c.commit()
+	}
+	// Пока заявка ждала, ссылку могли отозвать или исчерпать
+	var link activeInviteLink
+	err = c.Get(&link, `
+		SELECT *, expires_at IS NOT NULL AND expires_at <= now() AS expired
+		FROM chat_invite_links WHERE id = $1 FOR UPDATE
+	`, linkID)
+	if err != nil || !link.usable() {
+		return ErrInvalidInvite
+	}
+	if err := checkNotBanned(c, chatID, requesterID); err != nil {
+		return err
+	}
+	joined, err := joinViaLink(c.Tx, chatID, linkID, requesterID)
+	if err != nil {
+		return err
+	}
+	if joined {
+		if err := announceJoin(c, chatID, requesterID); err != nil {
+			return err
+		}
+	}
+	return c.commit()
+}
+
+// joinViaLink добавляет участника и учитывает использование ссылки.
+// Возвращает false, если пользователь уже состоял в группе.
+func joinViaLink(tx *sqlx.Tx, chatID, linkID, userID int) (bool, error) {
+	res, err := tx.Exec(`
+		INSERT INTO chat_members (chat_id, user_id, last_read_message_id)
+		VALUES ($1, $2, COALESCE((SELECT MAX(id) FROM messages WHERE chat_id = $1), 0))
+		ON CONFLICT DO NOTHING
+	`, chatID, userID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return false, err
+	}
+	if _, err := tx.Exec("UPDATE chat_invite_links SET uses = uses + 1 WHERE id=$1", linkID); err != nil {
+		return false, err
+	}
+	_, err = tx.Exec("INSERT INTO chat_invite_joins (link_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		linkID, userID)
+	return err == nil, err
+}
+
+// announceJoin пишет служебное сообщение о вступлении и сообщает о новом участнике
+func announceJoin(c *change, chatID, userID int) error {
+	action := models.MessageAction{Type: ActionMemberJoined, UserIDs: []int{userID}}
+	return announceMembers(c, chatID, userID, action, "joined the group via invite link")
+}
+
+// notifyJoinRequested сообщает о заявке тем, кто может ее рассмотреть
+func notifyJoinRequested(c *change, chatID, requesterID int) error {
+	var adminIDs []int
+	err := c.Select(&adminIDs, `
+		SELECT user_id FROM chat_members
+		WHERE chat_id = $1 AND (role = $2 OR (role = $3 AND $4 = ANY(permissions)))
+	`, chatID, RoleOwner, RoleAdmin, PermInviteUsers)
+	if err != nil {
+		return err
+	}
+	return c.notifyUsers(adminIDs, realtime.Event{Type: realtime.EventJoinRequested, ChatID: chatID,
+		Data: joinRequested{UserID: requesterID}})
+}
@@ -0,0 +1,32 @@
+package chat
+
+import (
+	"testing"
+	"time"
+	"messenger/internal/models"
+)
+
+func TestActiveInviteLinkUsable(t *testing.T) {
+	now := time.Now()
+	limit := func(n int) *int { return &n }
+	tests := []struct {
+		name string
+		link activeInviteLink
+		want bool
+	}{
+		{"unlimited", activeInviteLink{}, true},
+		{"uses left", activeInviteLink{InviteLink: models.InviteLink{MaxUses: limit(3), Uses: 2}}, true},
+		{"uses exhausted", activeInviteLink{InviteLink: models.InviteLink{MaxUses: limit(3), Uses: 3}}, false},
+		{"over limit", activeInviteLink{InviteLink: models.InviteLink{MaxUses: limit(1), Uses: 5}}, false},
+		{"expired", activeInviteLink{Expired: true}, false},
+		{"revoked", activeInviteLink{InviteLink: models.InviteLink{RevokedAt: &now}}, false},
+		{"revoked with uses left", activeInviteLink{InviteLink: models.InviteLink{RevokedAt: &now, MaxUses: limit(10)}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.link.usable(); got != tt.want {
+				t.Errorf("usable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
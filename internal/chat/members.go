@@ -0,0 +1,96 @@
+package chat
+
+import (
+	"database/sql"
+	"errors"
+	"messenger/internal/db"
+
+	"github.com/lib/pq"
+)
+
+// Роли участников чата
+const (
+	RoleMember = "member"
+	RoleAdmin  = "admin"
+	RoleOwner  = "owner" // создатель группы, обладает всеми правами
+)
+
+// Права администраторов группы
+const (
+	PermChangeInfo     = "change_info"     // менять название, описание и настройки группы
+	PermDeleteMessages = "delete_messages" // удалять чужие сообщения
+	PermBanUsers       = "ban_users"       // исключать и блокировать участников
+	PermInviteUsers    = "invite_users"    // добавлять участников
+	PermPinMessages    = "pin_messages"    // закреплять сообщения
+	PermAddAdmins      = "add_admins"      // назначать администраторов
+)
+
+// AllPermissions — полный набор прав администратора
+var AllPermissions = []string{
+	PermChangeInfo, PermDeleteMessages, PermBanUsers,
+	PermInviteUsers, PermPinMessages, PermAddAdmins,
+}
+
+// ErrNotMember возвращается, если пользователь не состоит в чате
+var ErrNotMember = errors.New("user is not a member of this chat")
+
+// ErrNoPermission возвращается, если у участника недостаточно прав для действия
+var ErrNoPermission = errors.New("not enough rights for this action")
+
+// checkMember проверяет, является ли пользователь участником чата
+func checkMember(chatID, userID int) error {
+	var count int
+	err := db.DB.Get(&count, "SELECT COUNT(*) FROM chat_members WHERE chat_id=$1 AND user_id=$2",
+		chatID, userID)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotMember
+	}
+	return nil
+}
+
+// memberRights — роль и права участника чата
+type memberRights struct {
+	Role        string         `db:"role"`
+	Permissions pq.StringArray `db:"permissions"`
+}
+
+// getMemberRights получает роль и права участника чата
+func getMemberRights(chatID, userID int) (*memberRights, error) {
+	var rights memberRights
+	err := db.DB.Get(&rights, "SELECT role, permissions FROM chat_members WHERE chat_id=$1 AND user_id=$2",
+		chatID, userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotMember
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rights, nil
+}
+
+// can проверяет право участника: владельцу разрешено все,
+// администратору — выданное, обычному участнику — ничего
+func (m *memberRights) can(permission string) bool {
+	switch m.Role {
+	case RoleOwner:
+		return true
+	case RoleAdmin:
+		return containsString(m.Permissions, permission)
+	}
+	return false
+}
+
+// checkPermission проверяет, что пользователь состоит в чате и имеет право
+func checkPermission(chatID, userID int, permission string) (*memberRights, error) {
+	rights, err := getMemberRights(chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !rights.can(permission) {
+		return nil, ErrNoPermission
+	}
+	return rights, nil
+}
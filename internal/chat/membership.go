@@ -0,0 +1,204 @@
+package chat
+
+import (
+	"errors"
+	"messenger/internal/db"
+	"messenger/internal/models"
+	"messenger/internal/realtime"
+
+	"github.com/lib/pq"
+)
+
+// membersChanged — данные события об изменении состава группы
+type membersChanged struct {
+	Action  string `json:"action"`
+	UserIDs []int  `json:"user_ids"`
+}
+
+// checkGroup проверяет, что чат — группа: состав личных чатов не меняется
+func checkGroup(chatID int) error {
+	var isGroup bool
+	if err := db.DB.Get(&isGroup, "SELECT is_group FROM chats WHERE id=$1", chatID); err != nil {
+		return errors.New("chat not found")
+	}
+	if !isGroup {
+		return errors.New("members can only be changed in group chats")
+	}
+	return nil
+}
+
+// AddMembers добавляет пользователей в группу. Нужно право invite_users;
+// те, кто уже состоит в группе, заблокированные и несуществующие
+// пользователи пропускаются.
+// Новые участники видят историю, но она не считается для них непрочитанной.
+func AddMembers(chatID, userID int, memberIDs []int) ([]int, error) {
+	if len(memberIDs) == 0 {
+		return nil, errors.New("no users to add")
+	}
+	if err := checkGroup(chatID); err != nil {
+		return nil, err
+	}
+	if _, err := checkPermission(chatID, userID, PermInviteUsers); err != nil {
+		return nil, err
+	}
+	ids := make([]int64, len(memberIDs))
+	for i, id := range memberIDs {
+		ids[i] = int64(id)
+	}
+	c, err := beginChange()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Rollback()
+	var added []int
+	err = c.Select(&added, `
+		INSERT INTO chat_members (chat_id, user_id, last_read_message_id)
+		SELECT $1, u.id, COALESCE((SELECT MAX(id) FROM messages WHERE chat_id = $1), 0)
+		FROM users u WHERE u.id = ANY($2)
+		AND NOT EXISTS (SELECT 1 FROM chat_bans b WHERE b.chat_id = $1 AND b.user_id = u.id)
+		ON CONFLICT DO NOTHING
+		RETURNING user_id
+	`, chatID, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	if len(added) == 0 {
+		return nil, errors.New("users are already members, banned or do not exist")
+	}
+	action := models.MessageAction{Type: ActionMembersAdded, UserIDs: added}
+	if err := announceMembers(c, chatID, userID, action, "added", added...); err != nil {
+		return nil, err
+	}
+	if err := c.commit(); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// announceMembers пишет служебное сообщение о пополнении состава и сообщает
+// о нем участникам. В каналах подписчики не видят друг друга: событие
+// получают только новые подписчики, а служебное сообщение не пишется.
+func announceMembers(c *change, chatID, actorID int, action models.MessageAction, verb string, targets ...int) error {
+	ev := realtime.Event{Type: realtime.EventMembersChanged, ChatID: chatID,
+		Data: membersChanged{Action: action.Type, UserIDs: action.UserIDs}}
+	if isChannel(chatID) {
+		return c.notifyUsers(action.UserIDs, ev)
+	}
+	text, err := describeAction(chatID, actorID, verb, targets...)
+	if err != nil {
+		return err
+	}
+	if _, err := sendServiceMessage(c, chatID, actorID, action, text); err != nil {
+		return err
+	}
+	return c.notifyChat(chatID, ev)
+}
+
+// RemoveMember исключает участника из группы. Нужно право ban_users; владельца
+// исключить нельзя, администраторов — только владельцу, а себя — только выходом.
+func RemoveMember(chatID, userID, memberID int) error {
+	if userID == memberID {
+		return errors.New("use leave to exit the group")
+	}
+	if err := checkGroup(chatID); err != nil {
+		return err
+	}
+	rights, err := checkPermission(chatID, userID, PermBanUsers)
+	if err != nil {
+		return err
+	}
+	target, err := getMemberRights(chatID, memberID)
+	if err != nil {
+		return err
+	}
+	if target.Role == RoleOwner {
+		return errors.New("cannot remove the owner")
+	}
+	if target.Role == RoleAdmin && rights.Role != RoleOwner {
+		return errors.New("only the owner can remove admins")
+	}
+	text, err := describeAction(chatID, userID, "removed", memberID)
+	if err != nil {
+		return err
+	}
+	c, err := beginChange()
+	if err != nil {
+		return err
+	}
+	defer c.Rollback()
+	err = removeMember(c, chatID, userID, memberID,
+		models.MessageAction{Type: ActionMemberRemoved, UserIDs: []int{memberID}}, text)
+	if err != nil {
+		return err
+	}
+	return c.commit()
+}
+
+// LeaveChat выводит пользователя из группы. Владелец может выйти,
+// только передав права или оставшись единственным участником.
+func LeaveChat(chatID, userID int) error {
+	if err := checkGroup(chatID); err != nil {
+		return err
+	}
+	rights, err := getMemberRights(chatID, userID)
+	if err != nil {
+		return err
+	}
+	if rights.Role == RoleOwner {
+		var others int
+		err := db.DB.Get(&others, "SELECT COUNT(*) FROM chat_members WHERE chat_id=$1 AND user_id<>$2",
+			chatID, userID)
+		if err != nil {
+			return err
+		}
+		if others > 0 {
+			return errors.New("transfer ownership before leaving the group")
+		}
+	}
+	text, err := describeAction(chatID, userID, "left the group")
+	if err != nil {
+		return err
+	}
+	c, err := beginChange()
+	if err != nil {
+		return err
+	}
+	defer c.Rollback()
+	err = removeMember(c, chatID, userID, userID,
+		models.MessageAction{Type: ActionMemberLeft, UserIDs: []int{userID}}, text)
+	if err != nil {
+		return err
+	}
+	return c.commit()
+}
+
+// removeMember удаляет участника вместе с его подписками на ветки чата,
+// после чего он перестает получать события группы. Служебное сообщение
+// отправляется до удаления, чтобы бывший участник тоже его получил;
+// в каналах его нет, а событие получает только сам бывший подписчик.
+func removeMember(c *change, chatID, actorID, memberID int, action models.MessageAction, text string) error {
+	channel := isChannel(chatID)
+	if !channel {
+		if _, err := sendServiceMessage(c, chatID, actorID, action, text); err != nil {
+			return err
+		}
+	}
+	if _, err := c.Exec("DELETE FROM chat_members WHERE chat_id=$1 AND user_id=$2", chatID, memberID); err != nil {
+		return err
+	}
+	_, err := c.Exec(`
+		DELETE FROM thread_followers
+		WHERE user_id = $2 AND root_message_id IN (SELECT id FROM messages WHERE chat_id = $1)
+	`, chatID, memberID)
+	if err != nil {
+		return err
+	}
+	ev := realtime.Event{Type: realtime.EventMembersChanged, ChatID: chatID,
+		Data: membersChanged{Action: action.Type, UserIDs: []int{memberID}}}
+	if !channel {
+		if err := c.notifyChat(chatID, ev); err != nil {
+			return err
+		}
+	}
+	return c.notifyUsers([]int{memberID}, ev)
+}
@@ -2,62 +2,311 @@ package chat
 
 import (
 	"errors"
+	"math"
+	"strconv"
 	"messenger/internal/db"
 	"messenger/internal/models"
+	"messenger/internal/realtime"
+
+	"github.com/jmoiron/sqlx"
 )
 
+// SendOptions — дополнительные параметры отправки сообщения
+type SendOptions struct {
+	ReplyToMessageID int   // сообщение, на которое отвечают
+	ThreadRootID     int   // корневое сообщение ветки
+	AttachmentIDs    []int // загруженные отправителем вложения
+}
+
 // SendMessage отправляет сообщение в чат
-func SendMessage(chatID, senderID int, text string) (*models.Message, error) {
-	if text == "" {
+func SendMessage(chatID, senderID int, text string, opts SendOptions) (*models.Message, error) {
+	if text == "" && len(opts.AttachmentIDs) == 0 {
 		return nil, errors.New("message text cannot be empty")
 	}
-	// Проверяем, является ли отправитель участником чата
-	var count int
-	err := db.DB.Get(&count, "SELECT COUNT(*) FROM chat_members WHERE chat_id=$1 AND user_id=$2",
-		chatID, senderID)
+	// Проверяем, может ли отправитель писать в чат
+	senderChatID, err := checkCanPost(chatID, senderID)
 	if err != nil {
 		return nil, err
 	}
-	if count == 0 {
-		return nil, errors.New("user is not a member of this chat")
+	var replyTo, threadRoot *int
+	if opts.ReplyToMessageID != 0 {
+		if err := checkReplyTarget(chatID, opts.ReplyToMessageID); err != nil {
+			return nil, err
+		}
+		replyTo = &opts.ReplyToMessageID
+	}
+	if opts.ThreadRootID != 0 {
+		if err := checkThreadRoot(chatID, opts.ThreadRootID); err != nil {
+			return nil, err
+		}
+		threadRoot = &opts.ThreadRootID
+	}
+	// Сохраняем сообщение вместе с вложениями
+	c, err := beginChange()
+	if err != nil {
+		return nil, err
 	}
-	// Сохраняем сообщение
+	defer c.Rollback()
 	var messageID int
-	err = db.DB.QueryRow(
-		"INSERT INTO messages (chat_id, sender_id, text) VALUES ($1, $2, $3) RETURNING id",
-		chatID, senderID, text,
-	).Scan(&messageID)
+	err = c.QueryRow(`
+		INSERT INTO messages (chat_id, sender_id, sender_chat_id, text, reply_to_message_id, thread_root_id)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id
+	`, chatID, senderID, senderChatID, text, replyTo, threadRoot).Scan(&messageID)
 	if err != nil {
 		return nil, err
 	}
-	// Получаем созданное сообщение
-	var message models.Message
-	err = db.DB.Get(&message, "SELECT * FROM messages WHERE id=$1", messageID)
-	return &message, err
+	if err := attachToMessage(c.Tx, messageID, senderID, opts.AttachmentIDs); err != nil {
+		return nil, err
+	}
+	var thread *threadUpdated
+	if threadRoot != nil {
+		if thread, err = addThreadReply(c.Tx, *threadRoot, senderID, messageID); err != nil {
+			return nil, err
+		}
+	}
+	// Получаем созданное сообщение и сообщаем о нем участникам
+	message, err := getMessage(c, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if err := decorateMessages(c, []*models.Message{message}, senderID); err != nil {
+		return nil, err
+	}
+	if err := c.notifyChat(chatID, realtime.Event{Type: realtime.EventNewMessage, Data: message}); err != nil {
+		return nil, err
+	}
+	if thread != nil {
+		if err := notifyThreadUpdated(c, chatID, thread); err != nil {
+			return nil, err
+		}
+	}
+	if err := takeSendRate(c.Tx, chatID, senderID, 1); err != nil {
+		return nil, err
+	}
+	if err := c.commit(); err != nil {
+		refundMessageTokens(senderID, 1)
+		return nil, err
+	}
+	return message, nil
+}
+
+// MaxMessagesLimit — верхняя граница количества сообщений за один запрос
+const MaxMessagesLimit = 100
+
+// MessagesQuery задает выборку сообщений чата. Одновременно может быть
+// задан только один курсор; без курсора возвращаются последние сообщения.
+type MessagesQuery struct {
+	Limit    int
+	BeforeID int // сообщения старше указанного
+	AfterID  int // сообщения новее указанного
+	AroundID int // сообщения вокруг указанного, включая его самого
+
+	IncludeThreads bool // включать в ленту сообщения веток
+}
+
+// MessagesPage — страница сообщений, упорядоченная от новых к старым
+type MessagesPage struct {
+	Messages      []models.Message
+	HasMoreBefore bool // есть более старые сообщения
+	HasMoreAfter  bool // есть более новые сообщения
 }
 
-// GetChatMessages получает сообщения из чата
-func GetChatMessages(chatID, userID int, limit int) ([]models.Message, error) {
+// GetChatMessages получает страницу сообщений из чата.
+// Сообщения веток в основную ленту не попадают, если не задан IncludeThreads.
+func GetChatMessages(chatID, userID int, query MessagesQuery) (*MessagesPage, error) {
+	// Проверяем, является ли пользователь участником чата
+	if err := checkMember(chatID, userID); err != nil {
+		return nil, err
+	}
+	scope := messageScope{chatID: chatID, userID: userID, includeThreads: query.IncludeThreads}
+	return getMessagesPage(scope, query)
+}
+
+// getMessagesPage выбирает страницу сообщений по курсорам запроса
+func getMessagesPage(scope messageScope, query MessagesQuery) (*MessagesPage, error) {
+	limit := query.Limit
 	if limit <= 0 {
 		limit = 50 // По умолчанию 50 сообщений
 	}
-	// Проверяем, является ли пользователь участником чата
-	var count int
-	err := db.DB.Get(&count, "SELECT COUNT(*) FROM chat_members WHERE chat_id=$1 AND user_id=$2",
-		chatID, userID)
+	if limit > MaxMessagesLimit {
+		limit = MaxMessagesLimit
+	}
+	cursors := 0
+	for _, id := range []int{query.BeforeID, query.AfterID, query.AroundID} {
+		if id < 0 {
+			return nil, errors.New("invalid cursor")
+		}
+		if id > 0 {
+			cursors++
+		}
+	}
+	if cursors > 1 {
+		return nil, errors.New("only one of before_id, after_id, around_id is allowed")
+	}
+
+	var err error
+	page := &MessagesPage{Messages: []models.Message{}}
+	switch {
+	case query.AfterID > 0:
+		newer, more, err := selectNewer(scope, query.AfterID, false, limit)
+		if err != nil {
+			return nil, err
+		}
+		page.Messages = reverseMessages(newer)
+		page.HasMoreAfter = more
+	case query.AroundID > 0:
+		// Половина страницы — старше курсора, остальное — сам курсор и новее
+		older, moreBefore, err := selectOlder(scope, query.AroundID, limit/2)
+		if err != nil {
+			return nil, err
+		}
+		newer, moreAfter, err := selectNewer(scope, query.AroundID, true, limit-limit/2)
+		if err != nil {
+			return nil, err
+		}
+		page.Messages = append(reverseMessages(newer), older...)
+		page.HasMoreBefore = moreBefore
+		page.HasMoreAfter = moreAfter
+	default:
+		// Без курсора берем самые новые сообщения
+		beforeID := query.BeforeID
+		if beforeID == 0 {
+			beforeID = math.MaxInt32
+		}
+		older, more, err := selectOlder(scope, beforeID, limit)
+		if err != nil {
+			return nil, err
+		}
+		page.Messages = older
+		page.HasMoreBefore = more
+	}
+
+	// Для курсоров, не примыкающих к краю, проверяем наличие сообщений за страницей
+	if query.AfterID > 0 {
+		page.HasMoreBefore, err = hasMessages(scope, "id <= $3", query.AfterID)
+	} else if query.BeforeID > 0 {
+		page.HasMoreAfter, err = hasMessages(scope, "id >= $3", query.BeforeID)
+	}
 	if err != nil {
 		return nil, err
 	}
-	if count == 0 {
-		return nil, errors.New("user is not a member of this chat")
+	if err := decorateMessages(db.DB, messagePointers(page.Messages), scope.userID); err != nil {
+		return nil, err
+	}
+	if !scope.preview {
+		if err := countViews(scope.userID, messagePointers(page.Messages)); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// decorateMessages дополняет сообщения цитатами ответов и реакциями
+// с точки зрения пользователя viewerID. У постов каналов скрывается,
+// кто из администраторов их написал.
+func decorateMessages(q sqlx.Queryer, messages []*models.Message, viewerID int) error {
+	if err := loadReplyPreviews(q, messages); err != nil {
+		return err
+	}
+	if err := loadAttachments(q, messages); err != nil {
+		return err
 	}
-	// Получаем сообщения
+	for _, m := range messages {
+		if m.SenderChatID != nil {
+			m.SenderID = 0
+		}
+	}
+	return loadReactions(q, messages, viewerID)
+}
+
+// messageScope задает набор сообщений чата, видимых пользователю
+type messageScope struct {
+	chatID         int
+	userID         int
+	threadRootID   int  // только сообщения этой ветки
+	includeThreads bool // показывать сообщения веток в основной ленте
+	preview        bool // просмотр без вступления: просмотры постов не засчитываются
+}
+
+// where возвращает условие выборки сообщений: $1 — чат, $2 — пользователь.
+// Сообщения, скрытые пользователем у себя, не попадают в выборку.
+func (s messageScope) where() string {
+	cond := `chat_id = $1 AND NOT EXISTS (
+		SELECT 1 FROM message_hidden h
+		WHERE h.message_id = messages.id AND h.user_id = $2
+	)`
+	if s.threadRootID > 0 {
+		cond += " AND thread_root_id = " + strconv.Itoa(s.threadRootID)
+	} else if !s.includeThreads {
+		cond += " AND thread_root_id IS NULL"
+	}
+	return cond
+}
+
+// selectOlder выбирает до limit сообщений с id меньше beforeID, от новых к старым
+func selectOlder(scope messageScope, beforeID, limit int) ([]models.Message, bool, error) {
 	var messages []models.Message
-	err = db.DB.Select(&messages, `
+	err := db.DB.Select(&messages, `
 		SELECT * FROM messages
-		WHERE chat_id = $1
-		ORDER BY sent_at DESC
-		LIMIT $2
-	`, chatID, limit)
-	return messages, err
+		WHERE `+scope.where()+` AND id < $3
+		ORDER BY id DESC
+		LIMIT $4
+	`, scope.chatID, scope.userID, beforeID, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(messages) > limit {
+		return messages[:limit], true, nil
+	}
+	return messages, false, nil
+}
+
+// selectNewer выбирает до limit сообщений с id больше afterID
+// (или равным ему, если inclusive), от старых к новым
+func selectNewer(scope messageScope, afterID int, inclusive bool, limit int) ([]models.Message, bool, error) {
+	op := ">"
+	if inclusive {
+		op = ">="
+	}
+	var messages []models.Message
+	err := db.DB.Select(&messages, `
+		SELECT * FROM messages
+		WHERE `+scope.where()+` AND id `+op+` $3
+		ORDER BY id ASC
+		LIMIT $4
+	`, scope.chatID, scope.userID, afterID, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(messages) > limit {
+		return messages[:limit], true, nil
+	}
+	return messages, false, nil
+}
+
+// hasMessages проверяет, есть ли среди видимых сообщений подходящие под условие ($3 — id)
+func hasMessages(scope messageScope, cond string, id int) (bool, error) {
+	var exists bool
+	err := db.DB.Get(&exists,
+		"SELECT EXISTS (SELECT 1 FROM messages WHERE "+scope.where()+" AND "+cond+")",
+		scope.chatID, scope.userID, id)
+	return exists, err
+}
+
+// messagePointers возвращает указатели на элементы среза,
+// чтобы их можно было дополнить на месте
+func messagePointers(messages []models.Message) []*models.Message {
+	pointers := make([]*models.Message, len(messages))
+	for i := range messages {
+		pointers[i] = &messages[i]
+	}
+	return pointers
+}
+
+// reverseMessages разворачивает порядок сообщений на месте
+func reverseMessages(messages []models.Message) []models.Message {
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages
 }
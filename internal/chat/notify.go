@@ -0,0 +1,125 @@
+package chat
+
+import (
+	"encoding/json"
+	"log"
+	"messenger/internal/db"
+	"messenger/internal/realtime"
+	"messenger/internal/updates"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// change — транзакция изменения вместе с событиями о нем. События
+// записываются в журналы получателей в той же транзакции, поэтому
+// изменение не может зафиксироваться без записи о нем, и наоборот.
+type change struct {
+	*sqlx.Tx
+	events   realtime.Outbox
+	channels []channelEvent
+}
+
+// channelEvent — событие канала, записываемое один раз в журнал канала
+type channelEvent struct {
+	ev   realtime.Event
+	data json.RawMessage
+}
+
+// beginChange начинает изменение
+func beginChange() (*change, error) {
+	tx, err := db.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	return &change{Tx: tx}, nil
+}
+
+// commit записывает события в журнал, фиксирует изменение
+// и доставляет события подключенным получателям
+func (c *change) commit() error {
+	// Строки каналов блокируются раньше строк пользователей,
+	// в том же порядке, что и при изменении самих каналов
+	for i := range c.channels {
+		e := &c.channels[i]
+		pts, err := updates.AppendChannel(c.Tx, e.ev.ChatID, e.ev.Type, e.data)
+		if err != nil {
+			return err
+		}
+		e.ev.ChannelPts = pts
+	}
+	if err := c.events.Flush(c.Tx); err != nil {
+		return err
+	}
+	if err := c.Tx.Commit(); err != nil {
+		return err
+	}
+	c.events.Send()
+	for _, e := range c.channels {
+		sendChannelEvent(e.ev)
+	}
+	return nil
+}
+
+// notifyChat ставит в очередь событие для всех участников чата
+// на момент изменения. События канала пишутся в журнал канала:
+// подписчики догоняют его сами, а сразу получают только подключенные.
+func (c *change) notifyChat(chatID int, ev realtime.Event) error {
+	var t string
+	if err := c.Get(&t, "SELECT type FROM chats WHERE id=$1", chatID); err != nil {
+		return err
+	}
+	ev.ChatID = chatID
+	if t == ChatTypeChannel {
+		data, err := json.Marshal(ev.Data)
+		if err != nil {
+			return err
+		}
+		ev.Data = json.RawMessage(data)
+		c.channels = append(c.channels, channelEvent{ev: ev, data: data})
+		return nil
+	}
+	var memberIDs []int
+	if err := c.Select(&memberIDs, "SELECT user_id FROM chat_members WHERE chat_id=$1", chatID); err != nil {
+		return err
+	}
+	return c.events.Add(memberIDs, ev)
+}
+
+// sendChannelEvent доставляет записанное событие канала подключенным подписчикам
+func sendChannelEvent(ev realtime.Event) {
+	online := realtime.OnlineUsers()
+	if len(online) == 0 {
+		return
+	}
+	ids := make([]int64, len(online))
+	for i, id := range online {
+		ids[i] = int64(id)
+	}
+	var memberIDs []int
+	err := db.DB.Select(&memberIDs, "SELECT user_id FROM chat_members WHERE chat_id=$1 AND user_id = ANY($2)",
+		ev.ChatID, pq.Array(ids))
+	if err != nil {
+		log.Printf("notify channel %d: %v", ev.ChatID, err)
+		return
+	}
+	realtime.SendEphemeral(memberIDs, ev)
+}
+
+// notifyUsers ставит в очередь событие для перечисленных пользователей
+func (c *change) notifyUsers(userIDs []int, ev realtime.Event) error {
+	return c.events.Add(userIDs, ev)
+}
+
+// notifyChatEphemeral рассылает событие остальным участникам чата без записи в журнал
+func notifyChatEphemeral(chatID, exceptUserID int, ev realtime.Event) {
+	var memberIDs []int
+	err := db.DB.Select(&memberIDs, "SELECT user_id FROM chat_members WHERE chat_id=$1 AND user_id<>$2",
+		chatID, exceptUserID)
+	if err != nil {
+		log.Printf("notify chat %d: %v", chatID, err)
+		return
+	}
+	ev.ChatID = chatID
+	realtime.SendEphemeral(memberIDs, ev)
+}
@@ -0,0 +1,128 @@
+package chat
+
+import (
+	"errors"
+	"messenger/internal/db"
+	"messenger/internal/models"
+	"messenger/internal/realtime"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MaxPinnedMessages — сколько сообщений можно закрепить в одном чате
+const MaxPinnedMessages = 50
+
+// pinsUpdated — данные события об изменении закрепленных сообщений
+type pinsUpdated struct {
+	PinnedMessageIDs []int `json:"pinned_message_ids"`
+}
+
+// checkCanPin проверяет право закреплять сообщения: в личном чате оно есть
+// у обоих собеседников, в группах и каналах нужно право pin_messages
+func checkCanPin(chatID, userID int) error {
+	t, err := chatType(chatID)
+	if err != nil {
+		return err
+	}
+	if t == ChatTypePrivate {
+		return checkMember(chatID, userID)
+	}
+	_, err = checkPermission(chatID, userID, PermPinMessages)
+	return err
+}
+
+// getPinnedMessageIDs возвращает закрепленные сообщения чата, последнее закрепленное первым
+func getPinnedMessageIDs(q sqlx.Queryer, chatID int) ([]int, error) {
+	ids := []int{}
+	err := sqlx.Select(q, &ids, `
+		SELECT message_id FROM pinned_messages WHERE chat_id = $1
+		ORDER BY pinned_at DESC, message_id DESC
+	`, chatID)
+	return ids, err
+}
+
+// notifyPinsUpdated рассылает участникам актуальный список закрепленных сообщений
+func notifyPinsUpdated(c *change, chatID int) error {
+	ids, err := getPinnedMessageIDs(c, chatID)
+	if err != nil {
+		return err
+	}
+	return c.notifyChat(chatID, realtime.Event{Type: realtime.EventPinsUpdated, Data: pinsUpdated{PinnedMessageIDs: ids}})
+}
+
+// PinMessage закрепляет сообщение в его чате и пишет об этом служебное сообщение
+func PinMessage(messageID, userID int) error {
+	message, err := getMessage(db.DB, messageID)
+	if err != nil {
+		return err
+	}
+	if err := checkCanPin(message.ChatID, userID); err != nil {
+		return err
+	}
+	if message.DeletedAt != nil || message.Action != nil {
+		return errors.New("this message cannot be pinned")
+	}
+	c, err := beginChange()
+	if err != nil {
+		return err
+	}
+	defer c.Rollback()
+	var count int
+	err = c.Get(&count, "SELECT COUNT(*) FROM pinned_messages WHERE chat_id=$1", message.ChatID)
+	if err != nil {
+		return err
+	}
+	if count >= MaxPinnedMessages {
+		return errors.New("too many pinned messages")
+	}
+	result, err := c.Exec(`
+		INSERT INTO pinned_messages (chat_id, message_id, pinned_by) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`, message.ChatID, messageID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("message is already pinned")
+	}
+	text, err := describeAction(message.ChatID, userID, "pinned a message")
+	if err != nil {
+		return err
+	}
+	action := models.MessageAction{Type: ActionMessagePinned, MessageID: messageID}
+	if _, err := sendServiceMessage(c, message.ChatID, userID, action, text); err != nil {
+		return err
+	}
+	if err := notifyPinsUpdated(c, message.ChatID); err != nil {
+		return err
+	}
+	return c.commit()
+}
+
+// UnpinMessage открепляет сообщение
+func UnpinMessage(messageID, userID int) error {
+	message, err := getMessage(db.DB, messageID)
+	if err != nil {
+		return err
+	}
+	if err := checkCanPin(message.ChatID, userID); err != nil {
+		return err
+	}
+	c, err := beginChange()
+	if err != nil {
+		return err
+	}
+	defer c.Rollback()
+	result, err := c.Exec("DELETE FROM pinned_messages WHERE chat_id=$1 AND message_id=$2",
+		message.ChatID, messageID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("message is not pinned")
+	}
+	if err := notifyPinsUpdated(c, message.ChatID); err != nil {
+		return err
+	}
+	return c.commit()
+}
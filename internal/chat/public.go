@@ -0,0 +1,137 @@
+package chat
+
+import (
+	"errors"
+	"regexp"
+	"messenger/internal/db"
+	"messenger/internal/models"
+	"messenger/internal/realtime"
+	"messenger/internal/user"
+	"messenger/internal/utils"
+)
+
+// usernamePattern — публичное имя: 5–32 латинских буквы, цифры или _, начинается с буквы
+var usernamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{4,31}$`)
+
+// PreviewMessagesLimit — сколько последних сообщений публичного чата видно до вступления
+const PreviewMessagesLimit = 20
+
+// SetChatUsername задает публичное имя группы или канала; пустое имя делает
+// чат закрытым. Имена общие с пользователями. Нужно право change_info.
+func SetChatUsername(chatID, userID int, username string) (*models.Chat, error) {
+	if username != "" && !usernamePattern.MatchString(username) {
+		return nil, errors.New("invalid username")
+	}
+	if err := checkGroup(chatID); err != nil {
+		return nil, err
+	}
+	if _, err := checkPermission(chatID, userID, PermChangeInfo); err != nil {
+		return nil, err
+	}
+	var publicName *string
+	if username != "" {
+		publicName = &username
+	}
+	c, err := beginChange()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Rollback()
+	if err := user.ReleaseChatUsername(c.Tx, chatID); err != nil {
+		return nil, err
+	}
+	if publicName != nil {
+		if err := user.ClaimUsername(c.Tx, username, 0, chatID); err != nil {
+			return nil, err
+		}
+	}
+	var chat models.Chat
+	if err := c.Get(&chat, "UPDATE chats SET username=$1 WHERE id=$2 RETURNING *", publicName, chatID); err != nil {
+		return nil, err
+	}
+	if err := c.notifyChat(chatID, realtime.Event{Type: realtime.EventChatUpdated, Data: &chat}); err != nil {
+		return nil, err
+	}
+	if err := c.commit(); err != nil {
+		return nil, err
+	}
+	return &chat, nil
+}
+
+// getPublicChat находит группу или канал по публичному имени
+func getPublicChat(username string) (*models.ChatPreview, error) {
+	var chat models.ChatPreview
+	err := db.DB.Get(&chat, `
+		SELECT c.*, (SELECT COUNT(*) FROM chat_members cm WHERE cm.chat_id = c.id) AS member_count
+		FROM chats c WHERE lower(c.username) = lower($1)
+	`, username)
+	if err != nil {
+		return nil, errors.New("public chat not found")
+	}
+	return &chat, nil
+}
+
+// SearchPublicChats ищет группы и каналы по началу публичного имени или названия
+func SearchPublicChats(query string) ([]models.ChatPreview, error) {
+	var chats []models.ChatPreview
+	err := db.DB.Select(&chats, `
+		SELECT c.*, (SELECT COUNT(*) FROM chat_members cm WHERE cm.chat_id = c.id) AS member_count
+		FROM chats c
+		WHERE c.username IS NOT NULL AND (lower(c.username) LIKE $1 OR lower(c.name) LIKE $1)
+		ORDER BY member_count DESC, c.id
+		LIMIT $2
+	`, utils.LikePrefix(query), user.MaxSearchResults)
+	return chats, err
+}
+
+// GetPublicChatPreview показывает публичный чат и его последние сообщения
+// без вступления в него
+func GetPublicChatPreview(username string, viewerID int) (*models.ChatPreview, error) {
+	chat, err := getPublicChat(username)
+	if err != nil {
+		return nil, err
+	}
+	scope := messageScope{chatID: chat.ID, userID: viewerID, preview: true}
+	page, err := getMessagesPage(scope, MessagesQuery{Limit: PreviewMessagesLimit})
+	if err != nil {
+		return nil, err
+	}
+	chat.Messages = page.Messages
+	return chat, nil
+}
+
+// JoinPublicChat вступает в публичную группу или канал по имени
+func JoinPublicChat(username string, userID int) (*models.Chat, error) {
+	preview, err := getPublicChat(username)
+	if err != nil {
+		return nil, err
+	}
+	chat := preview.Chat
+	if err := checkMember(chat.ID, userID); err == nil {
+		return nil, errors.New("you are already a member of this chat")
+	}
+	c, err := beginChange()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Rollback()
+	if err := checkNotBanned(c, chat.ID, userID); err != nil {
+		return nil, err
+	}
+	_, err = c.Exec(`
+		INSERT INTO chat_members (chat_id, user_id, last_read_message_id)
+		VALUES ($1, $2, COALESCE((SELECT MAX(id) FROM messages WHERE chat_id = $1), 0))
+		ON CONFLICT DO NOTHING
+	`, chat.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	action := models.MessageAction{Type: ActionMemberJoined, UserIDs: []int{userID}}
+	if err := announceMembers(c, chat.ID, userID, action, "joined the group"); err != nil {
+		return nil, err
+	}
+	if err := c.commit(); err != nil {
+		return nil, err
+	}
+	return &chat, nil
+}
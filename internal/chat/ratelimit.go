@@ -0,0 +1,191 @@
+package chat
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+	"messenger/internal/models"
+	"messenger/internal/realtime"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Ограничение частоты сообщений пользователя по умолчанию, на весь сервер
+const (
+	DefaultMessageRateLimit    = 30
+	DefaultMessageRateInterval = time.Minute
+)
+
+// MaxSlowModeInterval — наибольший интервал медленного режима группы
+const MaxSlowModeInterval = time.Hour
+
+// RateLimitError возвращается, когда отправить сообщение можно будет только позже
+type RateLimitError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s, retry in %d seconds", e.Reason, e.RetrySeconds())
+}
+
+// RetrySeconds округляет время ожидания вверх до целых секунд
+func (e *RateLimitError) RetrySeconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+// messageBucket — запас сообщений пользователя, который пополняется со временем
+type messageBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// messageLimiter ограничивает частоту сообщений каждого пользователя:
+// limit сообщений подряд, затем по одному за interval/limit
+var messageLimiter = struct {
+	sync.Mutex
+	limit    int
+	interval time.Duration
+	buckets  map[int]*messageBucket
+}{
+	limit:    DefaultMessageRateLimit,
+	interval: DefaultMessageRateInterval,
+	buckets:  make(map[int]*messageBucket),
+}
+
+// SetMessageRateLimit задает общее для сервера ограничение: не больше limit
+// сообщений пользователя за interval. Нулевой limit снимает ограничение.
+func SetMessageRateLimit(limit int, interval time.Duration) error {
+	if limit < 0 || (limit > 0 && interval <= 0) {
+		return errors.New("invalid message rate limit")
+	}
+	messageLimiter.Lock()
+	defer messageLimiter.Unlock()
+	messageLimiter.limit = limit
+	messageLimiter.interval = interval
+	messageLimiter.buckets = make(map[int]*messageBucket)
+	return nil
+}
+
+// takeMessageTokens списывает n сообщений из запаса пользователя
+// или сообщает, сколько ждать, если запаса не хватает
+func takeMessageTokens(userID, n int) error {
+	messageLimiter.Lock()
+	defer messageLimiter.Unlock()
+	limit := messageLimiter.limit
+	if limit == 0 {
+		return nil
+	}
+	now := time.Now()
+	perToken := messageLimiter.interval / time.Duration(limit)
+	refill := func(b *messageBucket) float64 {
+		return math.Min(float64(limit), b.tokens+float64(now.Sub(b.updated))/float64(perToken))
+	}
+	b, ok := messageLimiter.buckets[userID]
+	if !ok {
+		b = &messageBucket{tokens: float64(limit), updated: now}
+		messageLimiter.buckets[userID] = b
+	}
+	b.tokens, b.updated = refill(b), now
+	need := math.Min(float64(n), float64(limit))
+	if b.tokens < need {
+		wait := time.Duration((need - b.tokens) * float64(perToken))
+		return &RateLimitError{Reason: "too many messages", RetryAfter: wait}
+	}
+	b.tokens -= need
+	if len(messageLimiter.buckets) > 10000 {
+		for id, other := range messageLimiter.buckets {
+			if refill(other) >= float64(limit) {
+				delete(messageLimiter.buckets, id)
+			}
+		}
+	}
+	return nil
+}
+
+// refundMessageTokens возвращает в запас n сообщений, которые не удалось сохранить
+func refundMessageTokens(userID, n int) {
+	messageLimiter.Lock()
+	defer messageLimiter.Unlock()
+	limit := float64(messageLimiter.limit)
+	if b, ok := messageLimiter.buckets[userID]; ok {
+		b.tokens = math.Min(limit, b.tokens+math.Min(float64(n), limit))
+	}
+}
+
+// takeSlowMode проверяет медленный режим группы и отмечает время сообщения:
+// обычный участник пишет не чаще раза в заданный интервал, на администраторов
+// он не действует. Строка участника блокируется до конца транзакции отправки,
+// поэтому параллельные сообщения проверяются по очереди.
+func takeSlowMode(tx *sqlx.Tx, chatID, userID int) error {
+	var wait float64
+	err := tx.Get(&wait, `
+		SELECT COALESCE(EXTRACT(EPOCH FROM
+			cm.last_sent_at + c.slow_mode_seconds * interval '1 second' - now()), 0)
+		FROM chat_members cm
+		JOIN chats c ON c.id = cm.chat_id
+		WHERE cm.chat_id = $1 AND cm.user_id = $2 AND cm.role = $3 AND c.slow_mode_seconds > 0
+		FOR UPDATE OF cm
+	`, chatID, userID, RoleMember)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return &RateLimitError{Reason: "slow mode is enabled",
+			RetryAfter: time.Duration(wait * float64(time.Second))}
+	}
+	_, err = tx.Exec("UPDATE chat_members SET last_sent_at=now() WHERE chat_id=$1 AND user_id=$2",
+		chatID, userID)
+	return err
+}
+
+// takeSendRate проверяет медленный режим чата и общее ограничение частоты
+// перед сохранением count сообщений. Вызывается последним перед фиксацией
+// транзакции: если она не удалась, запас нужно вернуть refundMessageTokens.
+func takeSendRate(tx *sqlx.Tx, chatID, userID, count int) error {
+	if err := takeSlowMode(tx, chatID, userID); err != nil {
+		return err
+	}
+	return takeMessageTokens(userID, count)
+}
+
+// SetSlowMode задает интервал медленного режима группы; 0 выключает его.
+// Нужно право change_info.
+func SetSlowMode(chatID, userID int, interval time.Duration) (*models.Chat, error) {
+	if interval < 0 || interval > MaxSlowModeInterval || interval%time.Second != 0 {
+		return nil, errors.New("invalid slow mode interval")
+	}
+	if err := checkGroup(chatID); err != nil {
+		return nil, err
+	}
+	if isChannel(chatID) {
+		return nil, errors.New("slow mode is not available in channels")
+	}
+	if _, err := checkPermission(chatID, userID, PermChangeInfo); err != nil {
+		return nil, err
+	}
+	c, err := beginChange()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Rollback()
+	var chat models.Chat
+	err = c.Get(&chat, "UPDATE chats SET slow_mode_seconds=$1 WHERE id=$2 RETURNING *",
+		int(interval/time.Second), chatID)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.notifyChat(chatID, realtime.Event{Type: realtime.EventChatUpdated, Data: &chat}); err != nil {
+		return nil, err
+	}
+	if err := c.commit(); err != nil {
+		return nil, err
+	}
+	return &chat, nil
+}
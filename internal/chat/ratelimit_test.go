@@ -0,0 +1,140 @@
+package chat
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// elapse сдвигает запас пользователя в прошлое, как будто прошло d
+func elapse(userID int, d time.Duration) {
+	messageLimiter.Lock()
+	defer messageLimiter.Unlock()
+	if b, ok := messageLimiter.buckets[userID]; ok {
+		b.updated = b.updated.Add(-d)
+	}
+}
+
+func TestTakeMessageTokens(t *testing.T) {
+	type step struct {
+		elapse time.Duration // сколько прошло перед шагом
+		take   int
+		refund int  // вернуть в запас вместо списания
+		ok     bool // списание прошло
+		wait   time.Duration
+	}
+	tests := []struct {
+		name  string
+		limit int
+		steps []step
+	}{
+		{"burst up to limit", 3, []step{
+			{take: 1, ok: true},
+			{take: 2, ok: true},
+			{take: 1, wait: time.Second},
+		}},
+		{"refill over time", 3, []step{
+			{take: 3, ok: true},
+			{take: 1, wait: time.Second},
+			{elapse: time.Second, take: 1, ok: true},
+			{take: 1, wait: time.Second},
+		}},
+		{"refill is capped at limit", 3, []step{
+			{elapse: time.Hour, take: 3, ok: true},
+			{take: 1, wait: time.Second},
+		}},
+		{"batch larger than limit takes whole bucket", 3, []step{
+			{take: 10, ok: true},
+			{take: 1, wait: time.Second},
+		}},
+		{"batch waits for missing tokens", 3, []step{
+			{take: 2, ok: true},
+			{take: 3, wait: 2 * time.Second},
+			{take: 1, ok: true},
+		}},
+		{"refund returns tokens", 3, []step{
+			{take: 3, ok: true},
+			{refund: 2},
+			{take: 2, ok: true},
+			{take: 1, wait: time.Second},
+		}},
+		{"refund is capped at limit", 3, []step{
+			{take: 1, ok: true},
+			{refund: 5},
+			{take: 3, ok: true},
+			{take: 1, wait: time.Second},
+		}},
+		{"no limit", 0, []step{
+			{take: 1000, ok: true},
+			{take: 1000, ok: true},
+		}},
+	}
+	defer SetMessageRateLimit(DefaultMessageRateLimit, DefaultMessageRateInterval)
+	const userID = 1
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interval := time.Duration(tt.limit) * time.Second // одно сообщение в секунду
+			if err := SetMessageRateLimit(tt.limit, interval); err != nil {
+				t.Fatal(err)
+			}
+			for i, s := range tt.steps {
+				elapse(userID, s.elapse)
+				if s.refund > 0 {
+					refundMessageTokens(userID, s.refund)
+					continue
+				}
+				err := takeMessageTokens(userID, s.take)
+				if s.ok {
+					if err != nil {
+						t.Fatalf("step %d: take %d: %v", i, s.take, err)
+					}
+					continue
+				}
+				var rateErr *RateLimitError
+				if !errors.As(err, &rateErr) {
+					t.Fatalf("step %d: take %d: got %v, want RateLimitError", i, s.take, err)
+				}
+				// Между шагами проходит немного реального времени
+				if d := s.wait - rateErr.RetryAfter; d < 0 || d > 100*time.Millisecond {
+					t.Errorf("step %d: RetryAfter = %v, want about %v", i, rateErr.RetryAfter, s.wait)
+				}
+			}
+		})
+	}
+}
+
+func TestSetMessageRateLimit(t *testing.T) {
+	defer SetMessageRateLimit(DefaultMessageRateLimit, DefaultMessageRateInterval)
+	tests := []struct {
+		limit    int
+		interval time.Duration
+		ok       bool
+	}{
+		{30, time.Minute, true},
+		{0, 0, true},
+		{-1, time.Minute, false},
+		{10, 0, false},
+	}
+	for _, tt := range tests {
+		if err := SetMessageRateLimit(tt.limit, tt.interval); (err == nil) != tt.ok {
+			t.Errorf("SetMessageRateLimit(%d, %v) = %v, want ok %v", tt.limit, tt.interval, err, tt.ok)
+		}
+	}
+}
+
+func TestRateLimitErrorRetrySeconds(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want int
+	}{
+		{time.Second, 1},
+		{1500 * time.Millisecond, 2},
+		{time.Millisecond, 1},
+		{0, 0},
+	}
+	for _, tt := range tests {
+		if got := (&RateLimitError{RetryAfter: tt.wait}).RetrySeconds(); got != tt.want {
+			t.Errorf("RetrySeconds() for %v = %d, want %d", tt.wait, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package chat
+
+import (
+	"errors"
+	"unicode/utf8"
+	"messenger/internal/db"
+	"messenger/internal/models"
+	"messenger/internal/realtime"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// maxEmojiLength — ограничение длины реакции в байтах (эмодзи бывают составными)
+const maxEmojiLength = 32
+
+// reactionsUpdated — данные события об изменении реакций на сообщение
+type reactionsUpdated struct {
+	MessageID int               `json:"message_id"`
+	UserID    int               `json:"user_id,omitempty"` // нет у реакций в каналах
+	Emoji     string            `json:"emoji"`
+	Added     bool              `json:"added"`
+	Reactions []models.Reaction `json:"reactions"`
+}
+
+// AddReaction ставит реакцию на сообщение
+func AddReaction(messageID, userID int, emoji string) error {
+	message, err := checkReactionTarget(messageID, userID)
+	if err != nil {
+		return err
+	}
+	if emoji == "" || len(emoji) > maxEmojiLength || !utf8.ValidString(emoji) {
+		return errors.New("invalid reaction")
+	}
+	var allowed pq.StringArray
+	if err := db.DB.Get(&allowed, "SELECT allowed_reactions FROM chats WHERE id=$1", message.ChatID); err != nil {
+		return err
+	}
+	if allowed != nil && !containsString(allowed, emoji) {
+		return errors.New("reaction is not allowed in this chat")
+	}
+	c, err := beginChange()
+	if err != nil {
+		return err
+	}
+	defer c.Rollback()
+	result, err := c.Exec(`
+		INSERT INTO message_reactions (message_id, user_id, emoji) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`, messageID, userID, emoji)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil
+	}
+	if err := notifyReactions(c, message, userID, emoji, true); err != nil {
+		return err
+	}
+	return c.commit()
+}
+
+// RemoveReaction убирает реакцию пользователя с сообщения
+func RemoveReaction(messageID, userID int, emoji string) error {
+	message, err := checkReactionTarget(messageID, userID)
+	if err != nil {
+		return err
+	}
+	c, err := beginChange()
+	if err != nil {
+		return err
+	}
+	defer c.Rollback()
+	result, err := c.Exec(
+		"DELETE FROM message_reactions WHERE message_id=$1 AND user_id=$2 AND emoji=$3",
+		messageID, userID, emoji)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil
+	}
+	if err := notifyReactions(c, message, userID, emoji, false); err != nil {
+		return err
+	}
+	return c.commit()
+}
+
+// SetAllowedReactions задает набор реакций, разрешенных в группе.
+// nil снимает ограничение, пустой список запрещает реакции.
+func SetAllowedReactions(chatID, userID int, emojis []string) error {
+	if _, err := checkPermission(chatID, userID, PermChangeInfo); err != nil {
+		return err
+	}
+	for _, emoji := range emojis {
+		if emoji == "" || len(emoji) > maxEmojiLength || !utf8.ValidString(emoji) {
+			return errors.New("invalid reaction")
+		}
+	}
+	var allowed pq.StringArray
+	if emojis != nil {
+		allowed = pq.StringArray(emojis)
+	}
+	_, err := db.DB.Exec("UPDATE chats SET allowed_reactions=$1 WHERE id=$2", allowed, chatID)
+	return err
+}
+
+// checkReactionTarget проверяет, что пользователь может реагировать на сообщение
+func checkReactionTarget(messageID, userID int) (*models.Message, error) {
+	message, err := getMessage(db.DB, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMember(message.ChatID, userID); err != nil {
+		return nil, err
+	}
+	if message.DeletedAt != nil {
+		return nil, errors.New("message was deleted")
+	}
+	return message, nil
+}
+
+// loadReactions заполняет сводку реакций для сообщений одним запросом
+func loadReactions(q sqlx.Queryer, messages []*models.Message, viewerID int) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(messages))
+	for i, m := range messages {
+		ids[i] = int64(m.ID)
+	}
+	var reactions []models.Reaction
+	err := sqlx.Select(q, &reactions, `
+		SELECT message_id, emoji, COUNT(*) AS count, BOOL_OR(user_id = $2) AS reacted
+		FROM message_reactions
+		WHERE message_id = ANY($1)
+		GROUP BY message_id, emoji
+		ORDER BY message_id, MIN(created_at)
+	`, pq.Array(ids), viewerID)
+	if err != nil {
+		return err
+	}
+	byMessage := make(map[int][]models.Reaction)
+	for _, r := range reactions {
+		byMessage[r.MessageID] = append(byMessage[r.MessageID], r)
+	}
+	for _, m := range messages {
+		m.Reactions = byMessage[m.ID]
+	}
+	return nil
+}
+
+// notifyReactions рассылает участникам новую сводку реакций на сообщение.
+// Подписчики канала не видят друг друга, поэтому, кто поставил реакцию,
+// узнает только он сам.
+func notifyReactions(c *change, message *models.Message, userID int, emoji string, added bool) error {
+	if err := loadReactions(c, []*models.Message{message}, 0); err != nil {
+		return err
+	}
+	if message.Reactions == nil {
+		message.Reactions = []models.Reaction{}
+	}
+	update := reactionsUpdated{
+		MessageID: message.ID,
+		UserID:    userID,
+		Emoji:     emoji,
+		Added:     added,
+		Reactions: message.Reactions,
+	}
+	if !isChannel(message.ChatID) {
+		return c.notifyChat(message.ChatID, realtime.Event{Type: realtime.EventReactionsUpdated, Data: update})
+	}
+	err := c.notifyUsers([]int{userID}, realtime.Event{Type: realtime.EventReactionsUpdated,
+		ChatID: message.ChatID, Data: update})
+	if err != nil {
+		return err
+	}
+	update.UserID = 0
+	return c.notifyChat(message.ChatID, realtime.Event{Type: realtime.EventReactionsUpdated, Data: update})
+}
+
+// containsString проверяет, есть ли строка в списке
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
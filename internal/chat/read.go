@@ -0,0 +1,80 @@
+package chat
+
+import (
+	"errors"
+	"messenger/internal/db"
+	"messenger/internal/realtime"
+)
+
+// readUpdated — данные события о прочтении сообщений
+type readUpdated struct {
+	UserID    int `json:"user_id"`
+	MessageID int `json:"message_id"`
+}
+
+// MarkRead отмечает сообщения чата прочитанными до messageID включительно
+func MarkRead(chatID, userID, messageID int) error {
+	if err := checkMember(chatID, userID); err != nil {
+		return err
+	}
+	message, err := getMessage(db.DB, messageID)
+	if err != nil {
+		return err
+	}
+	if message.ChatID != chatID {
+		return errors.New("message not found in this chat")
+	}
+	// Позиция прочтения только растет
+	c, err := beginChange()
+	if err != nil {
+		return err
+	}
+	defer c.Rollback()
+	result, err := c.Exec(`
+		UPDATE chat_members SET last_read_message_id = $3
+		WHERE chat_id = $1 AND user_id = $2 AND last_read_message_id < $3
+	`, chatID, userID, messageID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil
+	}
+	ev := realtime.Event{
+		Type:   realtime.EventReadUpdated,
+		ChatID: chatID,
+		Data:   readUpdated{UserID: userID, MessageID: messageID},
+	}
+	// Другие устройства пользователя обновят счетчик непрочитанных,
+	// а в личном чате собеседник увидит, что его сообщения прочитаны
+	recipients := []int{userID}
+	peerID, err := readReceiptPeer(chatID, userID)
+	if err != nil {
+		return err
+	}
+	if peerID != 0 {
+		recipients = append(recipients, peerID)
+	}
+	if err := c.notifyUsers(recipients, ev); err != nil {
+		return err
+	}
+	return c.commit()
+}
+
+// readReceiptPeer возвращает собеседника в личном чате, если оба участника
+// показывают отметки о прочтении, иначе 0
+func readReceiptPeer(chatID, userID int) (int, error) {
+	var peers []int
+	err := db.DB.Select(&peers, `
+		SELECT peer.user_id FROM chat_members peer
+		JOIN chats c ON c.id = peer.chat_id
+		JOIN users pu ON pu.id = peer.user_id
+		JOIN users u ON u.id = $2
+		WHERE peer.chat_id = $1 AND peer.user_id <> $2 AND c.is_group = false
+		AND pu.show_read_receipts AND u.show_read_receipts
+	`, chatID, userID)
+	if err != nil || len(peers) == 0 {
+		return 0, err
+	}
+	return peers[0], nil
+}
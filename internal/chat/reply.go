@@ -0,0 +1,65 @@
+package chat
+
+import (
+	"errors"
+	"messenger/internal/db"
+	"messenger/internal/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ReplyPreviewLength — сколько символов текста попадает в цитату ответа
+const ReplyPreviewLength = 100
+
+// checkReplyTarget проверяет, что на сообщение можно ответить в этом чате
+func checkReplyTarget(chatID, messageID int) error {
+	target, err := getMessage(db.DB, messageID)
+	if err != nil || target.ChatID != chatID {
+		return errors.New("reply target not found in this chat")
+	}
+	if target.DeletedAt != nil {
+		return errors.New("cannot reply to a deleted message")
+	}
+	return nil
+}
+
+// loadReplyPreviews заполняет цитаты сообщений, на которые отвечают,
+// одним запросом для всех сообщений. У постов канала автор не раскрывается.
+func loadReplyPreviews(q sqlx.Queryer, messages []*models.Message) error {
+	var ids []int64
+	for _, m := range messages {
+		if m.ReplyToMessageID != nil {
+			ids = append(ids, int64(*m.ReplyToMessageID))
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	var previews []models.MessagePreview
+	err := sqlx.Select(q, &previews, `
+		SELECT id, CASE WHEN sender_chat_id IS NULL THEN sender_id ELSE 0 END AS sender_id,
+			LEFT(text, $2) AS text, deleted_at IS NOT NULL AS deleted
+		FROM messages
+		WHERE id = ANY($1)
+	`, pq.Array(ids), ReplyPreviewLength)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int]models.MessagePreview, len(previews))
+	for _, p := range previews {
+		byID[p.ID] = p
+	}
+	for _, m := range messages {
+		if m.ReplyToMessageID == nil {
+			continue
+		}
+		preview, ok := byID[*m.ReplyToMessageID]
+		if !ok {
+			// Исходное сообщение не найдено — показываем как удаленное
+			preview = models.MessagePreview{ID: *m.ReplyToMessageID, Deleted: true}
+		}
+		m.ReplyTo = &preview
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package chat
+
+import (
+	"errors"
+	"messenger/internal/db"
+	"messenger/internal/models"
+	"messenger/internal/realtime"
+
+	"github.com/lib/pq"
+)
+
+// membersRoleChanged — действие события members_changed при смене ролей
+const membersRoleChanged = "role_changed"
+
+// GetChatMembers получает участников чата: сначала владелец, затем администраторы.
+// Подписчиков канала видят только администраторы.
+func GetChatMembers(chatID, userID int) ([]models.ChatMember, error) {
+	rights, err := getMemberRights(chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if rights.Role == RoleMember && isChannel(chatID) {
+		return nil, ErrNoPermission
+	}
+	var members []models.ChatMember
+	err = db.DB.Select(&members, `
+		SELECT cm.user_id, u.username, cm.role, cm.permissions,
+			CASE WHEN cm.restricted_until > now() THEN cm.restricted_until END AS restricted_until
+		FROM chat_members cm
+		JOIN users u ON u.id = cm.user_id
+		WHERE cm.chat_id = $1
+		ORDER BY CASE cm.role WHEN $2 THEN 0 WHEN $3 THEN 1 ELSE 2 END, u.username
+	`, chatID, RoleOwner, RoleAdmin)
+	return members, err
+}
+
+// PromoteAdmin назначает участника администратором с указанными правами
+// или меняет права администратора. Нужно право add_admins; выдать можно
+// только те права, что есть у самого пользователя. Права других
+// администраторов меняет только владелец.
+func PromoteAdmin(chatID, userID, targetID int, permissions []string) error {
+	if len(permissions) == 0 {
+		return errors.New("admin must have at least one permission")
+	}
+	for _, p := range permissions {
+		if !containsString(AllPermissions, p) {
+			return errors.New("unknown permission: " + p)
+		}
+	}
+	if err := checkGroup(chatID); err != nil {
+		return err
+	}
+	rights, err := checkPermission(chatID, userID, PermAddAdmins)
+	if err != nil {
+		return err
+	}
+	for _, p := range permissions {
+		if !rights.can(p) {
+			return errors.New("cannot grant a permission you do not have: " + p)
+		}
+	}
+	target, err := getMemberRights(chatID, targetID)
+	if err != nil {
+		return err
+	}
+	if target.Role == RoleOwner {
+		return errors.New("cannot change the owner's rights")
+	}
+	if target.Role == RoleAdmin && rights.Role != RoleOwner {
+		return errors.New("only the owner can change other admins")
+	}
+	// Ограничение на отправку с новым администратором снимается
+	c, err := beginChange()
+	if err != nil {
+		return err
+	}
+	defer c.Rollback()
+	_, err = c.Exec(`
+		UPDATE chat_members SET role = $1, permissions = $2, restricted_until = NULL
+		WHERE chat_id = $3 AND user_id = $4
+	`, RoleAdmin, pq.StringArray(permissions), chatID, targetID)
+	if err != nil {
+		return err
+	}
+	if err := notifyRoleChanged(c, chatID, targetID); err != nil {
+		return err
+	}
+	return c.commit()
+}
+
+// DemoteAdmin снимает с администратора его права. Снять можно себя,
+// других администраторов — только владельцу.
+func DemoteAdmin(chatID, userID, targetID int) error {
+	rights, err := getMemberRights(chatID, userID)
+	if err != nil {
+		return err
+	}
+	if userID != targetID && rights.Role != RoleOwner {
+		return errors.New("only the owner can demote admins")
+	}
+	target, err := getMemberRights(chatID, targetID)
+	if err != nil {
+		return err
+	}
+	if target.Role != RoleAdmin {
+		return errors.New("user is not an admin")
+	}
+	c, err := beginChange()
+	if err != nil {
+		return err
+	}
+	defer c.Rollback()
+	_, err = c.Exec("UPDATE chat_members SET role=$1, permissions='{}', restricted_until=NULL WHERE chat_id=$2 AND user_id=$3",
+		RoleMember, chatID, targetID)
+	if err != nil {
+		return err
+	}
+	if err := notifyRoleChanged(c, chatID, targetID); err != nil {
+		return err
+	}
+	return c.commit()
+}
+
+// TransferOwnership передает группу другому участнику.
+// Прежний владелец остается администратором со всеми правами.
+func TransferOwnership(chatID, userID, newOwnerID int) error {
+	if userID == newOwnerID {
+		return errors.New("you already own this group")
+	}
+	if err := checkGroup(chatID); err != nil {
+		return err
+	}
+	rights, err := getMemberRights(chatID, userID)
+	if err != nil {
+		return err
+	}
+	if rights.Role != RoleOwner {
+		return errors.New("only the owner can transfer ownership")
+	}
+	if err := checkMember(chatID, newOwnerID); err != nil {
+		return err
+	}
+	// Новый владелец канала, как и другие администраторы, не раскрывается
+	verb := "transferred ownership to"
+	action := models.MessageAction{Type: ActionOwnerChanged, UserIDs: []int{newOwnerID}}
+	if isChannel(chatID) {
+		verb = "has a new owner"
+		action.UserIDs = nil
+	}
+	text, err := describeAction(chatID, userID, verb, newOwnerID)
+	if err != nil {
+		return err
+	}
+	c, err := beginChange()
+	if err != nil {
+		return err
+	}
+	defer c.Rollback()
+	_, err = c.Exec("UPDATE chat_members SET role=$1, permissions='{}', restricted_until=NULL WHERE chat_id=$2 AND user_id=$3",
+		RoleOwner, chatID, newOwnerID)
+	if err != nil {
+		return err
+	}
+	_, err = c.Exec("UPDATE chat_members SET role=$1, permissions=$2 WHERE chat_id=$3 AND user_id=$4",
+		RoleAdmin, pq.StringArray(AllPermissions), chatID, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := sendServiceMessage(c, chatID, userID, action, text); err != nil {
+		return err
+	}
+	if err := notifyRoleChanged(c, chatID, userID, newOwnerID); err != nil {
+		return err
+	}
+	return c.commit()
+}
+
+// notifyRoleChanged сообщает участникам о смене ролей. Подписчики канала
+// не знают его администраторов: узнают только те, чья роль изменилась.
+func notifyRoleChanged(c *change, chatID int, userIDs ...int) error {
+	ev := realtime.Event{Type: realtime.EventMembersChanged, ChatID: chatID,
+		Data: membersChanged{Action: membersRoleChanged, UserIDs: userIDs}}
+	if isChannel(chatID) {
+		return c.notifyUsers(userIDs, ev)
+	}
+	return c.notifyChat(chatID, ev)
+}
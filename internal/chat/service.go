@@ -0,0 +1,97 @@
+package chat
+
+import (
+	"strings"
+	"messenger/internal/db"
+	"messenger/internal/models"
+	"messenger/internal/realtime"
+
+	"github.com/lib/pq"
+)
+
+// Типы служебных сообщений
+const (
+	ActionMembersAdded  = "members_added"
+	ActionMemberRemoved = "member_removed"
+	ActionMemberLeft    = "member_left"
+	ActionMemberJoined  = "member_joined"
+	ActionMemberBanned  = "member_banned"
+	ActionOwnerChanged  = "owner_changed"
+	ActionMessagePinned = "message_pinned"
+
+	ActionTitleChanged       = "title_changed"
+	ActionDescriptionChanged = "description_changed"
+	ActionPhotoChanged       = "photo_changed"
+	ActionPhotoRemoved       = "photo_removed"
+)
+
+// sendServiceMessage сохраняет в рамках изменения служебное сообщение о событии
+// чата и рассылает его участникам. Текст описывает событие для клиентов, не знающих тип действия.
+// В канале сообщение подписывается от имени канала, как и посты.
+func sendServiceMessage(c *change, chatID, actorID int, action models.MessageAction, text string) (*models.Message, error) {
+	var senderChatID *int
+	if isChannel(chatID) {
+		senderChatID = &chatID
+	}
+	var messageID int
+	err := c.QueryRow(`
+		INSERT INTO messages (chat_id, sender_id, sender_chat_id, text, action)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id
+	`, chatID, actorID, senderChatID, text, action).Scan(&messageID)
+	if err != nil {
+		return nil, err
+	}
+	message, err := getMessage(c, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if err := decorateMessages(c, []*models.Message{message}, 0); err != nil {
+		return nil, err
+	}
+	if err := c.notifyChat(chatID, realtime.Event{Type: realtime.EventNewMessage, Data: message}); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// usernames возвращает имена пользователей по ID в том же порядке
+func usernames(userIDs []int) ([]string, error) {
+	var rows []struct {
+		ID       int    `db:"id"`
+		Username string `db:"username"`
+	}
+	ids := make([]int64, len(userIDs))
+	for i, id := range userIDs {
+		ids[i] = int64(id)
+	}
+	if err := db.DB.Select(&rows, "SELECT id, username FROM users WHERE id = ANY($1)", pq.Array(ids)); err != nil {
+		return nil, err
+	}
+	byID := make(map[int]string, len(rows))
+	for _, row := range rows {
+		byID[row.ID] = row.Username
+	}
+	names := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		names[i] = byID[id]
+	}
+	return names, nil
+}
+
+// describeAction составляет текст служебного сообщения вида "Alice added Bob".
+// В канале администраторы не раскрываются: действие описывается от имени
+// канала и без участников, например "Channel pinned a message".
+func describeAction(chatID, actorID int, verb string, userIDs ...int) (string, error) {
+	if isChannel(chatID) {
+		return "Channel " + verb, nil
+	}
+	names, err := usernames(append([]int{actorID}, userIDs...))
+	if err != nil {
+		return "", err
+	}
+	text := names[0] + " " + verb
+	if len(names) > 1 {
+		text += " " + strings.Join(names[1:], ", ")
+	}
+	return text, nil
+}
@@ -0,0 +1,225 @@
+package chat
+
+import (
+	"errors"
+	"time"
+	"messenger/internal/db"
+	"messenger/internal/models"
+	"messenger/internal/realtime"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// threadUpdated — данные события об изменении счетчиков ветки
+type threadUpdated struct {
+	RootMessageID int        `json:"root_message_id"`
+	ReplyCount    int        `json:"reply_count"`
+	LastReplyAt   *time.Time `json:"last_reply_at"`
+}
+
+// checkThreadRoot проверяет, что сообщение может быть корнем ветки в этом чате
+func checkThreadRoot(chatID, rootID int) error {
+	root, err := getMessage(db.DB, rootID)
+	if err != nil || root.ChatID != chatID {
+		return errors.New("thread root not found in this chat")
+	}
+	if root.ThreadRootID != nil {
+		return errors.New("cannot start a thread inside a thread")
+	}
+	if root.DeletedAt != nil {
+		return errors.New("cannot reply in a thread of a deleted message")
+	}
+	var isGroup bool
+	if err := db.DB.Get(&isGroup, "SELECT is_group FROM chats WHERE id=$1", chatID); err != nil {
+		return err
+	}
+	if !isGroup {
+		return errors.New("threads are only available in groups")
+	}
+	return nil
+}
+
+// addThreadReply обновляет счетчики корня после ответа в ветке и подписывает
+// на ветку автора ответа и автора корня. Выполняется в транзакции отправки,
+// чтобы ответ не сохранился без счетчиков.
+func addThreadReply(tx *sqlx.Tx, rootID, senderID, messageID int) (*threadUpdated, error) {
+	update := threadUpdated{RootMessageID: rootID}
+	var rootSenderID int
+	err := tx.QueryRow(`
+		UPDATE messages
+		SET thread_reply_count = thread_reply_count + 1, thread_last_reply_at = now()
+		WHERE id = $1
+		RETURNING thread_reply_count, thread_last_reply_at, sender_id
+	`, rootID).Scan(&update.ReplyCount, &update.LastReplyAt, &rootSenderID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO thread_followers (root_message_id, user_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, rootID, rootSenderID)
+	if err != nil {
+		return nil, err
+	}
+	// Свой ответ автор уже прочитал
+	_, err = tx.Exec(`
+		INSERT INTO thread_followers (root_message_id, user_id, last_read_message_id) VALUES ($1, $2, $3)
+		ON CONFLICT (root_message_id, user_id) DO UPDATE SET last_read_message_id = EXCLUDED.last_read_message_id
+	`, rootID, senderID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
+// removeThreadReply обновляет счетчики корня после удаления ответа в ветке.
+// Время последнего ответа пересчитывается по оставшимся ответам.
+func removeThreadReply(tx *sqlx.Tx, rootID int) (*threadUpdated, error) {
+	update := threadUpdated{RootMessageID: rootID}
+	err := tx.QueryRow(`
+		UPDATE messages
+		SET thread_reply_count = GREATEST(thread_reply_count - 1, 0),
+			thread_last_reply_at = (
+				SELECT MAX(r.sent_at) FROM messages r
+				WHERE r.thread_root_id = $1 AND r.deleted_at IS NULL
+			)
+		WHERE id = $1
+		RETURNING thread_reply_count, thread_last_reply_at
+	`, rootID).Scan(&update.ReplyCount, &update.LastReplyAt)
+	if err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
+// getThreadRoot получает корень ветки и проверяет доступ пользователя к чату
+func getThreadRoot(rootID, userID int) (*models.Message, error) {
+	root, err := getMessage(db.DB, rootID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMember(root.ChatID, userID); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// GetThreadMessages получает страницу сообщений ветки
+func GetThreadMessages(rootID, userID int, query MessagesQuery) (*MessagesPage, error) {
+	root, err := getThreadRoot(rootID, userID)
+	if err != nil {
+		return nil, err
+	}
+	scope := messageScope{chatID: root.ChatID, userID: userID, threadRootID: rootID}
+	return getMessagesPage(scope, query)
+}
+
+// GetThread получает корень ветки вместе с подпиской и числом непрочитанных
+func GetThread(rootID, userID int) (*models.Thread, error) {
+	root, err := getThreadRoot(rootID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := decorateMessages(db.DB, []*models.Message{root}, userID); err != nil {
+		return nil, err
+	}
+	thread := &models.Thread{Root: *root}
+	var lastRead []int
+	err = db.DB.Select(&lastRead,
+		"SELECT last_read_message_id FROM thread_followers WHERE root_message_id=$1 AND user_id=$2",
+		rootID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(lastRead) == 0 {
+		return thread, nil
+	}
+	thread.Following = true
+	thread.UnreadCount, err = threadUnreadCount(rootID, userID, lastRead[0])
+	return thread, err
+}
+
+// GetFollowedThreads получает ветки, на которые подписан пользователь,
+// начиная с самых активных
+func GetFollowedThreads(userID int) ([]models.Thread, error) {
+	var rows []struct {
+		models.Message
+		UnreadCount int `db:"unread_count"`
+	}
+	err := db.DB.Select(&rows, `
+		SELECT m.*, (
+			SELECT COUNT(*) FROM messages r
+			WHERE r.thread_root_id = m.id AND r.id > f.last_read_message_id
+			AND r.sender_id <> f.user_id AND r.deleted_at IS NULL
+		) AS unread_count
+		FROM messages m
+		JOIN thread_followers f ON f.root_message_id = m.id
+		JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = f.user_id
+		WHERE f.user_id = $1
+		ORDER BY m.thread_last_reply_at DESC NULLS LAST, m.id DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	threads := make([]models.Thread, 0, len(rows))
+	for _, row := range rows {
+		threads = append(threads, models.Thread{Root: row.Message, Following: true, UnreadCount: row.UnreadCount})
+	}
+	return threads, nil
+}
+
+// threadUnreadCount считает чужие сообщения ветки после позиции прочтения
+func threadUnreadCount(rootID, userID, lastReadID int) (int, error) {
+	var count int
+	err := db.DB.Get(&count, `
+		SELECT COUNT(*) FROM messages
+		WHERE thread_root_id = $1 AND id > $2 AND sender_id <> $3 AND deleted_at IS NULL
+	`, rootID, lastReadID, userID)
+	return count, err
+}
+
+// FollowThread подписывает пользователя на ветку или отписывает от нее
+func FollowThread(rootID, userID int, follow bool) error {
+	root, err := getThreadRoot(rootID, userID)
+	if err != nil {
+		return err
+	}
+	if root.ThreadRootID != nil {
+		return errors.New("message is not a thread root")
+	}
+	if !follow {
+		_, err = db.DB.Exec("DELETE FROM thread_followers WHERE root_message_id=$1 AND user_id=$2",
+			rootID, userID)
+		return err
+	}
+	// Новый подписчик начинает с текущего конца ветки
+	_, err = db.DB.Exec(`
+		INSERT INTO thread_followers (root_message_id, user_id, last_read_message_id)
+		SELECT $1, $2, COALESCE(MAX(id), 0) FROM messages WHERE thread_root_id = $1
+		ON CONFLICT DO NOTHING
+	`, rootID, userID)
+	return err
+}
+
+// MarkThreadRead отмечает ветку прочитанной до указанного сообщения
+func MarkThreadRead(rootID, userID, messageID int) error {
+	if _, err := getThreadRoot(rootID, userID); err != nil {
+		return err
+	}
+	result, err := db.DB.Exec(`
+		UPDATE thread_followers SET last_read_message_id = GREATEST(last_read_message_id, $3)
+		WHERE root_message_id = $1 AND user_id = $2
+	`, rootID, userID, messageID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("user does not follow this thread")
+	}
+	return nil
+}
+
+// notifyThreadUpdated рассылает новые счетчики ветки участникам чата
+func notifyThreadUpdated(c *change, chatID int, update *threadUpdated) error {
+	return c.notifyChat(chatID, realtime.Event{Type: realtime.EventThreadUpdated, Data: update})
+}
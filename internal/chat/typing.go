@@ -0,0 +1,107 @@
+package chat
+
+import (
+	"errors"
+	"sync"
+	"time"
+	"messenger/internal/realtime"
+)
+
+// Действия, о которых сообщает клиент
+const (
+	TypingActionTyping = "typing"
+	TypingActionCancel = "cancel"
+)
+
+const (
+	// Через сколько индикатор гаснет сам, если клиент не прислал новое действие
+	typingTimeout = 6 * time.Second
+	// Не чаще одного действия "печатает" от пользователя в чате за этот интервал;
+	// отмена рассылается, только если индикатор горит
+	typingRateInterval = 3 * time.Second
+)
+
+// typingUpdated — данные события о наборе текста
+type typingUpdated struct {
+	UserID    int    `json:"user_id"`
+	Action    string `json:"action"`
+	ExpiresIn int    `json:"expires_in,omitempty"` // секунд до автоматического сброса
+}
+
+type typingKey struct {
+	chatID int
+	userID int
+}
+
+// typingState — последнее разосланное "печатает" и горит ли индикатор
+type typingState struct {
+	typedAt time.Time
+	typing  bool
+}
+
+// typingLimiter помнит состояние индикатора пользователя в чате
+var typingLimiter = struct {
+	sync.Mutex
+	last map[typingKey]typingState
+}{last: make(map[typingKey]typingState)}
+
+// allowTyping решает, разослать ли действие, и чистит устаревшие записи.
+// Отмена не сбрасывает интервал, поэтому чередование "печатает" и отмены
+// дает не больше двух событий за typingRateInterval.
+func allowTyping(key typingKey, action string, now time.Time) bool {
+	typingLimiter.Lock()
+	defer typingLimiter.Unlock()
+	state, ok := typingLimiter.last[key]
+	if ok && now.Sub(state.typedAt) > typingTimeout {
+		// Индикатор уже погас сам
+		state.typing = false
+	}
+	if action == TypingActionCancel {
+		if !state.typing {
+			return false
+		}
+		state.typing = false
+		typingLimiter.last[key] = state
+		return true
+	}
+	if ok && now.Sub(state.typedAt) < typingRateInterval {
+		return false
+	}
+	typingLimiter.last[key] = typingState{typedAt: now, typing: true}
+	if len(typingLimiter.last) > 10000 {
+		for k, s := range typingLimiter.last {
+			if now.Sub(s.typedAt) > typingTimeout {
+				delete(typingLimiter.last, k)
+			}
+		}
+	}
+	return true
+}
+
+// SetTyping сообщает остальным участникам чата, что пользователь набирает текст
+// или перестал. Действия не сохраняются; слишком частые "печатает" и повторные
+// отмены отбрасываются. В каналах набор не показывается: событие раскрыло бы,
+// кто из администраторов пишет пост.
+func SetTyping(chatID, userID int, action string) error {
+	if action == "" {
+		action = TypingActionTyping
+	}
+	if action != TypingActionTyping && action != TypingActionCancel {
+		return errors.New("invalid typing action")
+	}
+	if isChannel(chatID) {
+		return errors.New("typing is not shown in channels")
+	}
+	if _, err := checkCanPost(chatID, userID); err != nil {
+		return err
+	}
+	if !allowTyping(typingKey{chatID: chatID, userID: userID}, action, time.Now()) {
+		return nil
+	}
+	update := typingUpdated{UserID: userID, Action: action}
+	if action == TypingActionTyping {
+		update.ExpiresIn = int(typingTimeout / time.Second)
+	}
+	notifyChatEphemeral(chatID, userID, realtime.Event{Type: realtime.EventTyping, Data: update})
+	return nil
+}
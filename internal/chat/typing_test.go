@@ -0,0 +1,52 @@
+package chat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllowTyping(t *testing.T) {
+	type step struct {
+		after  time.Duration // сколько прошло от первого шага
+		action string
+		want   bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"typing is throttled", []step{
+			{0, TypingActionTyping, true},
+			{time.Second, TypingActionTyping, false},
+			{typingRateInterval, TypingActionTyping, true},
+		}},
+		{"cancel only when typing", []step{
+			{0, TypingActionCancel, false},
+			{0, TypingActionTyping, true},
+			{time.Second, TypingActionCancel, true},
+			{time.Second, TypingActionCancel, false},
+		}},
+		{"cancel does not reset the interval", []step{
+			{0, TypingActionTyping, true},
+			{time.Second, TypingActionCancel, true},
+			{time.Second, TypingActionTyping, false},
+			{2 * time.Second, TypingActionCancel, false},
+			{typingRateInterval, TypingActionTyping, true},
+		}},
+		{"cancel after timeout is dropped", []step{
+			{0, TypingActionTyping, true},
+			{typingTimeout + time.Second, TypingActionCancel, false},
+		}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := typingKey{chatID: i + 1, userID: 1}
+			start := time.Now()
+			for j, s := range tt.steps {
+				if got := allowTyping(key, s.action, start.Add(s.after)); got != s.want {
+					t.Fatalf("step %d: allowTyping(%q) = %v, want %v", j, s.action, got, s.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// Теги EXIF, которые нужны при обработке
+const (
+	tagOrientation = 0x0112
+	tagGPSInfo     = 0x8825
+)
+
+// exifPrefix предваряет данные TIFF в сегменте APP1 у JPEG и иногда в WebP
+var exifPrefix = []byte("Exif\x00\x00")
+
+// typeSizes — размер одного значения EXIF по его типу
+var typeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// stripLocation удаляет геоданные из EXIF на месте, не меняя размер файла,
+// и возвращает ориентацию снимка (1, если она не указана)
+func stripLocation(data []byte, mimeType string) int {
+	switch mimeType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/webp":
+		return stripWebP(data)
+	}
+	return 1
+}
+
+// stripJPEG обрабатывает сегменты APP1 с EXIF до начала данных изображения
+func stripJPEG(data []byte) int {
+	orientation := 1
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		if marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			i += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			break
+		}
+		segment := data[i+4 : end]
+		if marker == 0xE1 && bytes.HasPrefix(segment, exifPrefix) {
+			orientation = scrubTIFF(segment[len(exifPrefix):])
+		}
+		i = end
+	}
+	return orientation
+}
+
+// stripPNG обрабатывает чанк eXIf и пересчитывает его контрольную сумму
+func stripPNG(data []byte) int {
+	orientation := 1
+	for i := 8; i+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			break
+		}
+		if string(data[i+4:i+8]) == "eXIf" {
+			orientation = scrubTIFF(data[i+8 : i+8+length])
+			binary.BigEndian.PutUint32(data[i+8+length:], crc32.ChecksumIEEE(data[i+4:i+8+length]))
+		}
+		i = end
+	}
+	return orientation
+}
+
+// stripWebP обрабатывает чанк EXIF контейнера RIFF
+func stripWebP(data []byte) int {
+	orientation := 1
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return orientation
+	}
+	for i := 12; i+8 <= len(data); {
+		length := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + length
+		if length < 0 || end > len(data) {
+			break
+		}
+		if string(data[i:i+4]) == "EXIF" {
+			orientation = scrubTIFF(bytes.TrimPrefix(data[i+8:end], exifPrefix))
+		}
+		i = end + length%2
+	}
+	return orientation
+}
+
+// scrubTIFF очищает каталог GPS в данных TIFF и возвращает ориентацию.
+// Поврежденные данные пропускаются без ошибки.
+func scrubTIFF(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	orientation := 1
+	ifd := order.Uint32(tiff[4:])
+	forEachEntry(tiff, order, ifd, func(entry []byte) {
+		switch order.Uint16(entry) {
+		case tagOrientation:
+			if v := int(order.Uint16(entry[8:])); v >= 1 && v <= 8 {
+				orientation = v
+			}
+		case tagGPSInfo:
+			clearIFD(tiff, order, order.Uint32(entry[8:]))
+		}
+	})
+	return orientation
+}
+
+// forEachEntry вызывает fn для каждой 12-байтной записи каталога по смещению offset
+func forEachEntry(tiff []byte, order binary.ByteOrder, offset uint32, fn func(entry []byte)) int {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	start := int(offset) + 2
+	if start+count*12 > len(tiff) {
+		return 0
+	}
+	for n := 0; n < count; n++ {
+		fn(tiff[start+n*12 : start+(n+1)*12])
+	}
+	return count
+}
+
+// clearIFD затирает значения всех записей каталога и сами записи
+func clearIFD(tiff []byte, order binary.ByteOrder, offset uint32) {
+	count := forEachEntry(tiff, order, offset, func(entry []byte) {
+		size := uint64(typeSizes[order.Uint16(entry[2:])]) * uint64(order.Uint32(entry[4:]))
+		if size > 4 {
+			if at := uint64(order.Uint32(entry[8:])); at+size <= uint64(len(tiff)) {
+				clear(tiff[at : at+size])
+			}
+		}
+		clear(entry)
+	})
+	if count > 0 {
+		order.PutUint16(tiff[offset:], 0)
+	}
+}
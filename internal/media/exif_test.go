@@ -0,0 +1,171 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+// Смещения в тестовом блоке TIFF
+const (
+	testGPSOffset      = 38 // каталог GPS сразу после IFD0
+	testLatitudeOffset = 68 // значение GPSLatitude после каталога GPS
+	testTIFFSize       = 92
+)
+
+// testLatitude — широта 55°45'12.34" в виде трех дробей
+var testLatitude = []uint32{55, 1, 45, 1, 1234, 100}
+
+// buildTIFF собирает блок TIFF с ориентацией в IFD0 и каталогом GPS
+func buildTIFF(order binary.ByteOrder, orientation int) []byte {
+	tiff := make([]byte, testTIFFSize)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	entry := func(at int, tag, typ uint16, count, value uint32) {
+		order.PutUint16(tiff[at:], tag)
+		order.PutUint16(tiff[at+2:], typ)
+		order.PutUint32(tiff[at+4:], count)
+		order.PutUint32(tiff[at+8:], value)
+	}
+	// IFD0: ориентация и ссылка на каталог GPS
+	order.PutUint16(tiff[8:], 2)
+	entry(10, tagOrientation, 3, 1, 0)
+	order.PutUint16(tiff[18:], uint16(orientation))
+	entry(22, tagGPSInfo, 4, 1, testGPSOffset)
+	// Каталог GPS: GPSLatitudeRef хранится в записи, GPSLatitude — отдельно
+	order.PutUint16(tiff[testGPSOffset:], 2)
+	entry(testGPSOffset+2, 1, 2, 2, 0)
+	copy(tiff[testGPSOffset+10:], "N\x00")
+	entry(testGPSOffset+14, 2, 5, 3, testLatitudeOffset)
+	for i, v := range testLatitude {
+		order.PutUint32(tiff[testLatitudeOffset+i*4:], v)
+	}
+	return tiff
+}
+
+// wrapJPEG вставляет сегмент APP1 с EXIF сразу после SOI
+func wrapJPEG(tiff, image []byte) []byte {
+	segment := append(append([]byte{}, exifPrefix...), tiff...)
+	data := []byte{0xFF, 0xD8, 0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(data[4:], uint16(len(segment)+2))
+	data = append(data, segment...)
+	return append(data, image[2:]...)
+}
+
+// pngChunk кодирует чанк PNG с контрольной суммой
+func pngChunk(kind string, payload []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	chunk = append(append(chunk, kind...), payload...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+func buildPNG(tiff []byte) []byte {
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = append(data, pngChunk("eXIf", tiff)...)
+	return append(data, pngChunk("IEND", nil)...)
+}
+
+func buildWebP(tiff []byte) []byte {
+	chunk := append([]byte("EXIF"), binary.LittleEndian.AppendUint32(nil, uint32(len(tiff)))...)
+	chunk = append(chunk, tiff...)
+	data := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(chunk)+4))...)
+	return append(append(data, "WEBP"...), chunk...)
+}
+
+// checkScrubbed проверяет, что от геоданных в tiff ничего не осталось
+func checkScrubbed(t *testing.T, tiff []byte, order binary.ByteOrder) {
+	t.Helper()
+	if n := order.Uint16(tiff[testGPSOffset:]); n != 0 {
+		t.Errorf("GPS IFD has %d entries, want 0", n)
+	}
+	if !bytes.Equal(tiff[testGPSOffset+2:testTIFFSize], make([]byte, testTIFFSize-testGPSOffset-2)) {
+		t.Errorf("GPS data left: % x", tiff[testGPSOffset:])
+	}
+	if tag := order.Uint16(tiff[10:]); tag != tagOrientation {
+		t.Errorf("IFD0 orientation entry damaged: tag %#x", tag)
+	}
+}
+
+func TestScrubTIFF(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for _, orientation := range []int{1, 3, 6, 8} {
+			tiff := buildTIFF(order, orientation)
+			if got := scrubTIFF(tiff); got != orientation {
+				t.Errorf("%v: scrubTIFF() = %d, want %d", order, got, orientation)
+			}
+			checkScrubbed(t, tiff, order)
+		}
+	}
+}
+
+func TestScrubTIFFInvalidOrientation(t *testing.T) {
+	tiff := buildTIFF(binary.LittleEndian, 9)
+	if got := scrubTIFF(tiff); got != 1 {
+		t.Errorf("scrubTIFF() = %d, want 1", got)
+	}
+}
+
+func TestStripLocation(t *testing.T) {
+	tests := []struct {
+		mimeType string
+		build    func(tiff []byte) []byte
+		tiffAt   func(data []byte) []byte // где в файле лежит блок TIFF
+	}{
+		{"image/jpeg", func(tiff []byte) []byte { return wrapJPEG(tiff, []byte{0xFF, 0xD8, 0xFF, 0xD9}) },
+			func(data []byte) []byte { return data[12:] }},
+		{"image/png", buildPNG, func(data []byte) []byte { return data[16:] }},
+		{"image/webp", buildWebP, func(data []byte) []byte { return data[20:] }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mimeType, func(t *testing.T) {
+			data := tt.build(buildTIFF(binary.BigEndian, 6))
+			size := len(data)
+			if got := stripLocation(data, tt.mimeType); got != 6 {
+				t.Errorf("stripLocation() = %d, want 6", got)
+			}
+			if len(data) != size {
+				t.Errorf("size changed: %d, want %d", len(data), size)
+			}
+			checkScrubbed(t, tt.tiffAt(data), binary.BigEndian)
+		})
+	}
+}
+
+func TestStripPNGChecksum(t *testing.T) {
+	data := buildPNG(buildTIFF(binary.LittleEndian, 1))
+	stripLocation(data, "image/png")
+	length := int(binary.BigEndian.Uint32(data[8:]))
+	want := crc32.ChecksumIEEE(data[12 : 16+length])
+	if got := binary.BigEndian.Uint32(data[16+length:]); got != want {
+		t.Errorf("eXIf CRC = %#x, want %#x", got, want)
+	}
+}
+
+func TestStripLocationDamaged(t *testing.T) {
+	tiff := buildTIFF(binary.LittleEndian, 6)
+	// Каталог GPS указывает за пределы данных
+	binary.LittleEndian.PutUint32(tiff[30:], 1000)
+	tests := []struct {
+		name     string
+		data     []byte
+		mimeType string
+	}{
+		{"truncated tiff", wrapJPEG(tiff[:20], []byte{0xFF, 0xD8, 0xFF, 0xD9}), "image/jpeg"},
+		{"gps offset out of range", wrapJPEG(tiff, []byte{0xFF, 0xD8, 0xFF, 0xD9}), "image/jpeg"},
+		{"segment longer than file", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF, 0xFF, 'E'}, "image/jpeg"},
+		{"chunk longer than file", []byte("\x89PNG\r\n\x1a\n\x7f\xff\xff\xffeXIf"), "image/png"},
+		{"not riff", []byte("RIFX0000WEBP"), "image/webp"},
+		{"gif", []byte("GIF89a"), "image/gif"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stripLocation(tt.data, tt.mimeType) // не должно паниковать
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ThumbnailSizes — наибольшая сторона создаваемых превью, от меньшего к большему
+var ThumbnailSizes = []int{90, 320}
+
+// MaxPixels — изображения крупнее не обрабатываются, чтобы не расходовать память
+const MaxPixels = 50_000_000
+
+const (
+	thumbnailQuality = 80
+	// blurhashSide — до какого размера уменьшать изображение перед расчетом BlurHash
+	blurhashSide = 32
+)
+
+// Image — обработанное изображение
+type Image struct {
+	Data       []byte // исходный файл без геоданных EXIF
+	Width      int    // с учетом ориентации снимка
+	Height     int
+	Blurhash   string
+	Thumbnails []Thumbnail
+}
+
+// Thumbnail — уменьшенная копия изображения в формате JPEG
+type Thumbnail struct {
+	MaxSide int
+	Width   int
+	Height  int
+	Data    []byte
+}
+
+// Supported проверяет, умеет ли сервер обрабатывать изображения этого типа
+func Supported(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// Process удаляет из изображения геоданные, определяет его размеры, создает
+// превью и BlurHash. Данные data изменяются на месте.
+func Process(data []byte, mimeType string) (*Image, error) {
+	if !Supported(mimeType) {
+		return nil, errors.New("unsupported image type")
+	}
+	orientation := stripLocation(data, mimeType)
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxPixels {
+		return nil, errors.New("image is too large to process")
+	}
+	// У GIF берется первый кадр
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	result := &Image{Data: data, Width: config.Width, Height: config.Height}
+	if orientation >= 5 {
+		result.Width, result.Height = result.Height, result.Width
+	}
+	for _, side := range ThumbnailSizes {
+		if config.Width <= side && config.Height <= side {
+			break
+		}
+		thumb := orient(scale(src, side), orientation)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+			return nil, err
+		}
+		result.Thumbnails = append(result.Thumbnails, Thumbnail{MaxSide: side,
+			Width: thumb.Bounds().Dx(), Height: thumb.Bounds().Dy(), Data: buf.Bytes()})
+	}
+	small := orient(scale(src, blurhashSide), orientation)
+	xComponents, yComponents := 4, 3
+	if result.Height > result.Width {
+		xComponents, yComponents = 3, 4
+	}
+	result.Blurhash = blurhash(small, xComponents, yComponents)
+	return result, nil
+}
+
+// scale уменьшает изображение так, чтобы большая сторона не превышала maxSide.
+// Прозрачные области заливаются белым: в JPEG нет альфа-канала.
+func scale(src image.Image, maxSide int) *image.RGBA {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxSide || height > maxSide {
+		if width >= height {
+			width, height = maxSide, max(1, height*maxSide/width)
+		} else {
+			width, height = max(1, width*maxSide/height), maxSide
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+	return dst
+}
+
+// orient поворачивает и отражает изображение согласно ориентации EXIF
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.SetRGBA(dx, dy, src.RGBAAt(x, y))
+		}
+	}
+	return dst
+}
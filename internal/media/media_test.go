@@ -0,0 +1,170 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestScale(t *testing.T) {
+	tests := []struct {
+		width, height int
+		maxSide       int
+		wantW, wantH  int
+	}{
+		{1000, 500, 320, 320, 160},
+		{500, 1000, 320, 160, 320},
+		{640, 480, 90, 90, 67},
+		{320, 320, 320, 320, 320},
+		{100, 50, 320, 100, 50}, // меньшие изображения не увеличиваются
+		{1000, 1, 90, 90, 1},    // сторона не бывает меньше пикселя
+		{1, 1000, 90, 1, 90},
+	}
+	for _, tt := range tests {
+		src := image.NewRGBA(image.Rect(0, 0, tt.width, tt.height))
+		got := scale(src, tt.maxSide).Bounds()
+		if got.Dx() != tt.wantW || got.Dy() != tt.wantH {
+			t.Errorf("scale(%dx%d, %d) = %dx%d, want %dx%d", tt.width, tt.height, tt.maxSide,
+				got.Dx(), got.Dy(), tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestScaleFillsTransparency(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 10, 10)) // полностью прозрачное
+	if got := scale(src, 5).RGBAAt(2, 2); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("transparent pixel = %v, want white", got)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// Изображение 3x2 с отмеченным левым верхним пикселем
+	red := color.RGBA{255, 0, 0, 255}
+	tests := []struct {
+		orientation  int
+		wantW, wantH int
+		wantX, wantY int // где окажется отмеченный пиксель
+	}{
+		{1, 3, 2, 0, 0},
+		{2, 3, 2, 2, 0},
+		{3, 3, 2, 2, 1},
+		{4, 3, 2, 0, 1},
+		{5, 2, 3, 0, 0},
+		{6, 2, 3, 1, 0},
+		{7, 2, 3, 1, 2},
+		{8, 2, 3, 0, 2},
+		{9, 3, 2, 0, 0}, // неизвестная ориентация не меняет изображение
+	}
+	for _, tt := range tests {
+		src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+		src.SetRGBA(0, 0, red)
+		dst := orient(src, tt.orientation)
+		if b := dst.Bounds(); b.Dx() != tt.wantW || b.Dy() != tt.wantH {
+			t.Errorf("orient(%d) size = %dx%d, want %dx%d", tt.orientation, b.Dx(), b.Dy(), tt.wantW, tt.wantH)
+			continue
+		}
+		if got := dst.RGBAAt(tt.wantX, tt.wantY); got != red {
+			t.Errorf("orient(%d): pixel (%d, %d) = %v, want marked", tt.orientation, tt.wantX, tt.wantY, got)
+		}
+	}
+}
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// encodeJPEG кодирует JPEG с EXIF, где указана ориентация и есть геоданные
+func encodeJPEG(t *testing.T, width, height, orientation int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return wrapJPEG(buildTIFF(binary.BigEndian, orientation), buf.Bytes())
+}
+
+func TestProcessSizes(t *testing.T) {
+	type size struct{ side, w, h int }
+	tests := []struct {
+		name          string
+		data          []byte
+		mimeType      string
+		width, height int
+		thumbnails    []size
+	}{
+		{"landscape", encodePNG(t, 640, 480), "image/png", 640, 480,
+			[]size{{90, 90, 67}, {320, 320, 240}}},
+		{"portrait", encodePNG(t, 200, 400), "image/png", 200, 400,
+			[]size{{90, 45, 90}, {320, 160, 320}}},
+		{"between sizes", encodePNG(t, 200, 100), "image/png", 200, 100,
+			[]size{{90, 90, 45}}},
+		{"small", encodePNG(t, 90, 60), "image/png", 90, 60, nil},
+		{"rotated by exif", encodeJPEG(t, 640, 480, 6), "image/jpeg", 480, 640,
+			[]size{{90, 67, 90}, {320, 240, 320}}},
+		{"flipped by exif", encodeJPEG(t, 640, 480, 3), "image/jpeg", 640, 480,
+			[]size{{90, 90, 67}, {320, 320, 240}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := Process(tt.data, tt.mimeType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Width != tt.width || img.Height != tt.height {
+				t.Errorf("size = %dx%d, want %dx%d", img.Width, img.Height, tt.width, tt.height)
+			}
+			if img.Blurhash == "" {
+				t.Error("blurhash is empty")
+			}
+			if len(img.Thumbnails) != len(tt.thumbnails) {
+				t.Fatalf("got %d thumbnails, want %d", len(img.Thumbnails), len(tt.thumbnails))
+			}
+			for i, want := range tt.thumbnails {
+				got := img.Thumbnails[i]
+				if got.MaxSide != want.side || got.Width != want.w || got.Height != want.h {
+					t.Errorf("thumbnail %d = %d: %dx%d, want %d: %dx%d", i,
+						got.MaxSide, got.Width, got.Height, want.side, want.w, want.h)
+				}
+				config, err := jpeg.DecodeConfig(bytes.NewReader(got.Data))
+				if err != nil || config.Width != want.w || config.Height != want.h {
+					t.Errorf("thumbnail %d decodes as %dx%d (%v), want %dx%d", i,
+						config.Width, config.Height, err, want.w, want.h)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessStripsLocation(t *testing.T) {
+	data := encodeJPEG(t, 100, 100, 1)
+	img, err := Process(data, "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkScrubbed(t, img.Data[12:], binary.BigEndian)
+}
+
+func TestProcessRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		mimeType string
+	}{
+		{"unsupported type", encodePNG(t, 10, 10), "image/bmp"},
+		{"not an image", []byte("hello"), "image/png"},
+	}
+	for _, tt := range tests {
+		if _, err := Process(tt.data, tt.mimeType); err == nil {
+			t.Errorf("%s: Process() succeeded, want error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Attachment — загруженный файл, который можно приложить к сообщению
+type Attachment struct {
+    ID         int       `db:"id" json:"id"`
+    UploaderID int       `db:"uploader_id" json:"-"`
+    StorageKey string    `db:"storage_key" json:"-"` // ключ содержимого в хранилище
+    Filename   string    `db:"filename" json:"filename"`
+    MimeType   string    `db:"mime_type" json:"mime_type"`
+    Size       int64     `db:"size" json:"size"` // байт
+    CreatedAt  time.Time `db:"created_at" json:"created_at"`
+
+    // Только у изображений
+    Width      int         `db:"width" json:"width,omitempty"`
+    Height     int         `db:"height" json:"height,omitempty"`
+    Blurhash   string      `db:"blurhash" json:"blurhash,omitempty"` // размытое превью до загрузки
+    Thumbnails []Thumbnail `db:"-" json:"thumbnails,omitempty"`
+}
+
+// Thumbnail — уменьшенная копия изображения в JPEG
+type Thumbnail struct {
+    AttachmentID int    `db:"attachment_id" json:"-"`
+    MaxSide      int    `db:"max_side" json:"max_side"` // наибольшая сторона; по ней превью и запрашивается
+    StorageKey   string `db:"storage_key" json:"-"`
+    Width        int    `db:"width" json:"width"`
+    Height       int    `db:"height" json:"height"`
+    Size         int64  `db:"size" json:"size"`
+}
@@ -1,8 +1,84 @@
 package models
 
-// Chat представляет чат (групповой или личный)
+import (
+    "time"
+
+    "github.com/lib/pq"
+)
+
+// Chat представляет чат: личный, группу или канал
 type Chat struct {
     ID      int    `db:"id" json:"id"`
     Name    string `db:"name" json:"name"`
-    IsGroup bool   `db:"is_group" json:"is_group"`
+    Type    string `db:"type" json:"type"`         // private, group или channel
+    IsGroup bool   `db:"is_group" json:"is_group"` // любой чат, кроме личного
+
+    Username *string `db:"username" json:"username,omitempty"` // публичное имя
+
+    Description string `db:"description" json:"description,omitempty"`
+    AvatarURL   string `db:"avatar_url" json:"avatar_url,omitempty"`
+
+    CreatedAt time.Time `db:"created_at" json:"created_at"`
+
+    SlowModeSeconds int `db:"slow_mode_seconds" json:"slow_mode_seconds,omitempty"` // 0 — медленный режим выключен
+
+    AllowedReactions pq.StringArray `db:"allowed_reactions" json:"allowed_reactions,omitempty"` // nil — любые
+
+    Pts int64 `db:"pts" json:"pts,omitempty"` // последняя запись журнала канала
+}
+
+// ChatListItem — чат в списке чатов пользователя
+type ChatListItem struct {
+    Chat
+    LastMessage    *ChatLastMessage `db:"-" json:"last_message,omitempty"`
+    Peer           *User            `db:"-" json:"peer,omitempty"` // собеседник в личном чате
+    MemberCount    int              `db:"member_count" json:"member_count"`
+    LastActivityAt time.Time        `db:"last_activity_at" json:"last_activity_at"`
+    UnreadCount       int `db:"unread_count" json:"unread_count"`
+    LastReadMessageID int `db:"last_read_message_id" json:"last_read_message_id"`
+    // Позиция прочтения собеседника в личном чате, если оба не скрывают ее
+    PeerLastReadMessageID *int `db:"peer_last_read_message_id" json:"peer_last_read_message_id,omitempty"`
+}
+
+// ChatLastMessage — последнее сообщение чата в списке чатов
+type ChatLastMessage struct {
+    ID       int       `json:"id"`
+    SenderID int       `json:"sender_id,omitempty"` // нет у постов каналов
+    Text     string    `json:"text"` // первые символы текста
+    SentAt   time.Time `json:"sent_at"`
+}
+
+// ChatInfo — сведения о чате для его участника
+type ChatInfo struct {
+    Chat
+    MemberCount     int            `db:"member_count" json:"member_count"`
+    Role            string         `db:"role" json:"role"` // роль запросившего
+    Permissions     pq.StringArray `db:"permissions" json:"permissions,omitempty"`
+    RestrictedUntil *time.Time     `db:"restricted_until" json:"restricted_until,omitempty"` // только чтение до этого времени
+
+    PinnedMessageIDs pq.Int64Array `db:"pinned_message_ids" json:"pinned_message_ids"` // последнее закрепленное — первое
+}
+
+// ChatPreview — публичный чат, каким его видит пользователь до вступления
+type ChatPreview struct {
+    Chat
+    MemberCount int       `db:"member_count" json:"member_count"`
+    Messages    []Message `db:"-" json:"messages,omitempty"` // последние сообщения
+}
+
+// ChatMember — участник чата с ролью и правами администратора
+type ChatMember struct {
+    UserID          int            `db:"user_id" json:"user_id"`
+    Username        string         `db:"username" json:"username"`
+    Role            string         `db:"role" json:"role"`
+    Permissions     pq.StringArray `db:"permissions" json:"permissions,omitempty"`
+    RestrictedUntil *time.Time     `db:"restricted_until" json:"restricted_until,omitempty"` // только чтение до этого времени
+}
+
+// BannedUser — пользователь, заблокированный в группе
+type BannedUser struct {
+    UserID    int       `db:"user_id" json:"user_id"`
+    Username  string    `db:"username" json:"username"`
+    BannedBy  int       `db:"banned_by" json:"banned_by"`
+    CreatedAt time.Time `db:"created_at" json:"created_at"`
 }
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// InviteLink — ссылка-приглашение в группу
+type InviteLink struct {
+    ID               int        `db:"id" json:"id"`
+    ChatID           int        `db:"chat_id" json:"chat_id"`
+    Token            string     `db:"token" json:"token"`
+    CreatorID        int        `db:"creator_id" json:"creator_id"`
+    CreatedAt        time.Time  `db:"created_at" json:"created_at"`
+    ExpiresAt        *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+    MaxUses          *int       `db:"max_uses" json:"max_uses,omitempty"`
+    Uses             int        `db:"uses" json:"uses"`
+    RequiresApproval bool       `db:"requires_approval" json:"requires_approval"`
+    RevokedAt        *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+
+    PendingRequests int `db:"pending_requests" json:"pending_requests"` // заявок ждут одобрения
+}
+
+// InviteJoin — вступление в группу по ссылке
+type InviteJoin struct {
+    UserID   int       `db:"user_id" json:"user_id"`
+    Username string    `db:"username" json:"username"`
+    JoinedAt time.Time `db:"joined_at" json:"joined_at"`
+}
+
+// JoinRequest — заявка на вступление в группу
+type JoinRequest struct {
+    UserID      int       `db:"user_id" json:"user_id"`
+    Username    string    `db:"username" json:"username"`
+    LinkID      int       `db:"link_id" json:"link_id"`
+    RequestedAt time.Time `db:"requested_at" json:"requested_at"`
+}
+
+// InvitePreview — сведения о группе, которые видно по ссылке до вступления
+type InvitePreview struct {
+    ChatID           int    `db:"chat_id" json:"chat_id"`
+    Title            string `db:"name" json:"title"`
+    Description      string `db:"description" json:"description,omitempty"`
+    AvatarURL        string `db:"avatar_url" json:"avatar_url,omitempty"`
+    MemberCount      int    `db:"member_count" json:"member_count"`
+    RequiresApproval bool   `db:"requires_approval" json:"requires_approval"`
+}
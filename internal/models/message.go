@@ -1,12 +1,85 @@
 package models
 
-import "time"
+import (
+    "database/sql/driver"
+    "encoding/json"
+    "errors"
+    "time"
+)
 
 // Message представляет сообщение в чате
 type Message struct {
-    ID       int       `db:"id" json:"id"`
-    ChatID   int       `db:"chat_id" json:"chat_id"`
-    SenderID int       `db:"sender_id" json:"sender_id"`
-    Text     string    `db:"text" json:"text"`
-    SentAt   time.Time `db:"sent_at" json:"sent_at"`
+    ID        int        `db:"id" json:"id"`
+    ChatID    int        `db:"chat_id" json:"chat_id"`
+    SenderID  int        `db:"sender_id" json:"sender_id,omitempty"` // скрыт у постов каналов
+    Text      string     `db:"text" json:"text"`
+    SentAt    time.Time  `db:"sent_at" json:"sent_at"`
+    EditedAt  *time.Time `db:"edited_at" json:"edited_at,omitempty"`
+    DeletedAt *time.Time `db:"deleted_at" json:"deleted_at,omitempty"` // удалено для всех
+
+    ReplyToMessageID *int            `db:"reply_to_message_id" json:"reply_to_message_id,omitempty"`
+    ReplyTo          *MessagePreview `db:"-" json:"reply_to,omitempty"`
+
+    ThreadRootID      *int       `db:"thread_root_id" json:"thread_root_id,omitempty"`
+    ThreadReplyCount  int        `db:"thread_reply_count" json:"thread_reply_count,omitempty"`
+    ThreadLastReplyAt *time.Time `db:"thread_last_reply_at" json:"thread_last_reply_at,omitempty"`
+
+    ForwardedFromUserID *int       `db:"forwarded_from_user_id" json:"forwarded_from_user_id,omitempty"`
+    ForwardedFromChatID *int       `db:"forwarded_from_chat_id" json:"forwarded_from_chat_id,omitempty"`
+    ForwardedFromSentAt *time.Time `db:"forwarded_from_sent_at" json:"forwarded_from_sent_at,omitempty"`
+
+    SenderChatID *int `db:"sender_chat_id" json:"sender_chat_id,omitempty"` // пост от имени канала
+    ViewCount    int  `db:"view_count" json:"views,omitempty"`
+
+    Action *MessageAction `db:"action" json:"action,omitempty"` // только у служебных сообщений
+
+    Reactions   []Reaction   `db:"-" json:"reactions,omitempty"`
+    Attachments []Attachment `db:"-" json:"attachments,omitempty"`
+}
+
+// MessageAction описывает событие чата, о котором рассказывает служебное сообщение.
+// Хранится в колонке JSONB.
+type MessageAction struct {
+    Type      string `json:"type"`
+    UserIDs   []int  `json:"user_ids,omitempty"`   // участники, которых касается событие
+    Title     string `json:"title,omitempty"`      // новое название группы
+    MessageID int    `json:"message_id,omitempty"` // закрепленное сообщение
+}
+
+// Scan читает действие из JSONB
+func (a *MessageAction) Scan(src interface{}) error {
+    data, ok := src.([]byte)
+    if !ok {
+        return errors.New("message action must be json")
+    }
+    return json.Unmarshal(data, a)
+}
+
+// Value сохраняет действие в JSONB
+func (a MessageAction) Value() (driver.Value, error) {
+    return json.Marshal(a)
+}
+
+// Reaction — сводка реакций одним эмодзи на сообщение
+type Reaction struct {
+    MessageID int    `db:"message_id" json:"-"`
+    Emoji     string `db:"emoji" json:"emoji"`
+    Count     int    `db:"count" json:"count"`
+    Reacted   bool   `db:"reacted" json:"reacted,omitempty"` // среди поставивших есть текущий пользователь
+}
+
+// MessagePreview — краткое представление сообщения для цитаты в ответе
+type MessagePreview struct {
+    ID       int    `db:"id" json:"id"`
+    SenderID int    `db:"sender_id" json:"sender_id"`
+    Text     string `db:"text" json:"text"`       // начало текста
+    Deleted  bool   `db:"deleted" json:"deleted"` // сообщение удалено, текста нет
+}
+
+// MessageEdit представляет предыдущую версию отредактированного сообщения
+type MessageEdit struct {
+    ID        int       `db:"id" json:"id"`
+    MessageID int       `db:"message_id" json:"message_id"`
+    Text      string    `db:"text" json:"text"`
+    EditedAt  time.Time `db:"edited_at" json:"edited_at"` // когда эта версия была заменена
 }
@@ -0,0 +1,8 @@
+package models
+
+// Thread представляет ветку обсуждения с точки зрения пользователя
+type Thread struct {
+    Root        Message `json:"root"`
+    Following   bool    `json:"following"`
+    UnreadCount int     `json:"unread_count"`
+}
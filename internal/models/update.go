@@ -0,0 +1,15 @@
+package models
+
+import (
+    "encoding/json"
+    "time"
+)
+
+// Update представляет запись в журнале обновлений пользователя
+type Update struct {
+    Pts       int64           `db:"pts" json:"pts"`
+    Type      string          `db:"type" json:"type"`
+    ChatID    int             `db:"chat_id" json:"chat_id,omitempty"`
+    Data      json.RawMessage `db:"data" json:"data,omitempty"`
+    CreatedAt time.Time       `db:"created_at" json:"created_at"`
+}
@@ -1,9 +1,27 @@
 package models
 
+import "time"
+
 // User представляет пользователя системы
 type User struct {
     ID       int    `db:"id" json:"id"`
     Username string `db:"username" json:"username"`
-    Email    string `db:"email" json:"email"`
+    Email    string `db:"email" json:"email,omitempty"`
     Password string `db:"password" json:"-"` // хеш пароля
+
+    Presence *Presence `db:"-" json:"presence,omitempty"` // сетевой статус с точки зрения запросившего
+}
+
+// Presence — сетевой статус пользователя. Status — online или offline,
+// если время последней активности видно, иначе приблизительное значение:
+// recently, within_week, within_month, long_ago.
+type Presence struct {
+    Status     string     `json:"status"`
+    LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// PrivacySettings — настройки приватности пользователя
+type PrivacySettings struct {
+    ShowReadReceipts bool   `db:"show_read_receipts" json:"show_read_receipts"`
+    LastSeen         string `db:"last_seen_privacy" json:"last_seen"` // everybody, contacts или nobody
 }
@@ -0,0 +1,170 @@
+package realtime
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Время на запись одного кадра
+	writeWait = 10 * time.Second
+	// Сколько ждем pong от клиента, прежде чем считать соединение мертвым
+	pongWait = 60 * time.Second
+	// Как часто сервер отправляет ping (должно быть меньше pongWait)
+	pingPeriod = pongWait * 9 / 10
+	// Максимальный размер входящего кадра
+	maxFrameSize = 64 * 1024
+	// Размер очереди исходящих кадров одного подключения
+	sendBufferSize = 64
+)
+
+// Frame представляет входящий кадр от клиента
+type Frame struct {
+	Type string          `json:"type"`
+	ID   string          `json:"id,omitempty"` // идентификатор запроса клиента для ответа
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Reply представляет ответ сервера на входящий кадр
+type Reply struct {
+	Type  string      `json:"type"`
+	ID    string      `json:"id,omitempty"`
+	Data  interface{} `json:"data,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
+
+// FrameHandler обрабатывает входящий кадр и возвращает данные ответа
+type FrameHandler func(c *Client, frame Frame) (interface{}, error)
+
+// Client представляет одно WebSocket-подключение пользователя
+type Client struct {
+	UserID  int
+	conn    *websocket.Conn
+	send    chan []byte
+	handler FrameHandler
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewClient создает подключение для пользователя
+func NewClient(userID int, conn *websocket.Conn, handler FrameHandler) *Client {
+	return &Client{
+		UserID:  userID,
+		conn:    conn,
+		send:    make(chan []byte, sendBufferSize),
+		handler: handler,
+		done:    make(chan struct{}),
+	}
+}
+
+// Run регистрирует подключение в хабе и обслуживает его до закрытия.
+// lastPts — pts последнего события, полученного клиентом до переподключения;
+// пропущенные с тех пор события будут отправлены первыми.
+func (c *Client) Run(lastPts int64) {
+	go c.writePump()
+	hub.subscribe(c.UserID, c, lastPts)
+	defer hub.unsubscribe(c.UserID, c)
+
+	c.readPump()
+}
+
+// Send ставит ответ в очередь отправки
+func (c *Client) Send(v interface{}) {
+	frame, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	c.enqueue(frame)
+}
+
+// hello реализует subscriber
+func (c *Client) hello(pts int64) {
+	c.Send(Reply{Type: EventHello, Data: map[string]interface{}{
+		"heartbeat_interval": int(pingPeriod / time.Second),
+		"pts":                pts,
+	}})
+}
+
+// deliver реализует subscriber
+func (c *Client) deliver(env envelope) {
+	c.enqueue(env.Frame)
+}
+
+// enqueue ставит кадр в очередь, не блокируясь. Если клиент не успевает
+// читать, соединение закрывается: после переподключения он догонит состояние.
+func (c *Client) enqueue(frame []byte) {
+	select {
+	case <-c.done:
+	case c.send <- frame:
+	default:
+		c.close()
+	}
+}
+
+// close закрывает соединение один раз
+func (c *Client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// readPump читает кадры клиента и передает их обработчику
+func (c *Client) readPump() {
+	defer c.close()
+	c.conn.SetReadLimit(maxFrameSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		var frame Frame
+		if err := c.conn.ReadJSON(&frame); err != nil {
+			return
+		}
+		// Любой кадр от клиента подтверждает, что соединение живо
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		if frame.Type == "ping" {
+			c.Send(Reply{Type: "pong", ID: frame.ID})
+			continue
+		}
+		if c.handler == nil {
+			continue
+		}
+		data, err := c.handler(c, frame)
+		if err != nil {
+			c.Send(Reply{Type: "error", ID: frame.ID, Error: err.Error()})
+			continue
+		}
+		c.Send(Reply{Type: "ack", ID: frame.ID, Data: data})
+	}
+}
+
+// writePump отправляет кадры из очереди и периодически пингует клиента
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.close()
+	}()
+	for {
+		select {
+		case <-c.done:
+			return
+		case frame := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, frame); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
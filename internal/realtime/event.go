@@ -0,0 +1,31 @@
+package realtime
+
+// Типы событий, рассылаемых клиентам
+const (
+	EventNewMessage       = "new_message"
+	EventMessageEdited    = "message_edited"
+	EventMessageDeleted   = "message_deleted"
+	EventThreadUpdated    = "thread_updated"
+	EventReactionsUpdated = "reactions_updated"
+	EventReadUpdated      = "read_updated"
+	EventTyping           = "typing"
+	EventChatCreated      = "chat_created"
+	EventMembersChanged   = "members_changed"
+	EventChatUpdated      = "chat_updated"
+	EventJoinRequested    = "join_requested"
+	EventPinsUpdated      = "pins_updated"
+	EventPresence         = "presence"
+	EventHello            = "hello"
+	// EventResync сообщает, что пропущенные события восстановить нельзя
+	// и клиенту нужно заново загрузить чаты и сообщения
+	EventResync = "resync"
+)
+
+// Event представляет событие, доставляемое клиенту в реальном времени
+type Event struct {
+	Pts        int64       `json:"pts,omitempty"`         // номер записи в журнале обновлений получателя
+	ChannelPts int64       `json:"channel_pts,omitempty"` // номер записи в журнале канала
+	Type       string      `json:"type"`
+	ChatID     int         `json:"chat_id,omitempty"`
+	Data       interface{} `json:"data,omitempty"`
+}
@@ -0,0 +1,223 @@
+package realtime
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"messenger/internal/updates"
+)
+
+// envelope — событие, подготовленное к доставке конкретному пользователю
+type envelope struct {
+	Pts   int64
+	Type  string
+	Frame []byte // JSON события
+}
+
+// Сколько пропущенных событий досылается при подписке. Остаток очереди
+// подписчика нужен для событий, которые придут, пока досылка не прочитана;
+// при большем разрыве клиент получает resync.
+const maxReplay = sendBufferSize / 2
+
+// subscriber — получатель событий пользователя (WebSocket или SSE)
+type subscriber interface {
+	// hello вызывается при подписке с pts, начиная с которого пойдут события
+	hello(pts int64)
+	deliver(env envelope)
+}
+
+// userState хранит подписчиков пользователя вместе с pts последнего
+// доставленного каждому из них события. Мьютекс сериализует доставку,
+// поэтому подписчики получают события в порядке pts.
+type userState struct {
+	mu   sync.Mutex
+	subs map[subscriber]int64
+	refs int // число подписчиков; защищено Hub.mu
+}
+
+// Hub хранит активные подключения пользователей
+type Hub struct {
+	mu    sync.Mutex
+	users map[int]*userState
+}
+
+var hub = &Hub{users: make(map[int]*userState)}
+
+// acquire возвращает состояние пользователя, создавая его при необходимости.
+// Состояние живет, пока на него есть ссылки: каждый вызов acquire
+// должен завершаться вызовом release.
+func (h *Hub) acquire(userID int) *userState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	st, ok := h.users[userID]
+	if !ok {
+		st = &userState{subs: make(map[subscriber]int64)}
+		h.users[userID] = st
+	}
+	st.refs++
+	return st
+}
+
+// release снимает ссылку на состояние и удаляет его из хаба,
+// когда у пользователя не осталось подписчиков
+func (h *Hub) release(userID int, st *userState) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	st.refs--
+	if st.refs == 0 {
+		delete(h.users, userID)
+	}
+}
+
+// subscribe регистрирует подписчика и досылает ему события после lastPts
+// из журнала обновлений. Если разрыв восстановить нельзя, вместо них
+// отправляется событие resync: клиенту нужно заново загрузить состояние.
+func (h *Hub) subscribe(userID int, s subscriber, lastPts int64) {
+	if h.attach(userID, s, lastPts) {
+		presenceChanged(userID)
+	}
+}
+
+// attach выполняет подписку под блокировкой пользователя. Ссылка
+// на состояние остается за подписчиком до unsubscribe.
+// Возвращает true, если это первое подключение пользователя.
+func (h *Hub) attach(userID int, s subscriber, lastPts int64) bool {
+	st := h.acquire(userID)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	first := len(st.subs) == 0
+	if lastPts <= 0 {
+		pts, err := updates.CurrentPts(userID)
+		if err != nil {
+			log.Printf("realtime: pts for user %d: %v", userID, err)
+		}
+		s.hello(pts)
+		st.subs[s] = pts
+		return first
+	}
+	s.hello(lastPts)
+	st.subs[s] = h.replay(userID, s, lastPts)
+	return first
+}
+
+// replay досылает подписчику события журнала после since и возвращает pts
+// последнего отправленного. Если разрыв слишком большой, вместо событий
+// отправляется resync.
+func (h *Hub) replay(userID int, s subscriber, since int64) int64 {
+	diff, err := updates.GetDifference(userID, since)
+	if err != nil {
+		log.Printf("realtime: difference for user %d: %v", userID, err)
+		return since
+	}
+	if diff.TooLong || len(diff.Updates) > maxReplay {
+		s.deliver(newEnvelope(Event{Pts: diff.Pts, Type: EventResync}))
+		return diff.Pts
+	}
+	for _, u := range diff.Updates {
+		s.deliver(newEnvelope(Event{Pts: u.Pts, Type: u.Type, ChatID: u.ChatID, Data: u.Data}))
+		since = u.Pts
+	}
+	return since
+}
+
+// unsubscribe удаляет подписчика из хаба
+func (h *Hub) unsubscribe(userID int, s subscriber) {
+	h.mu.Lock()
+	st, ok := h.users[userID]
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+	st.mu.Lock()
+	_, found := st.subs[s]
+	delete(st.subs, s)
+	last := len(st.subs) == 0
+	st.mu.Unlock()
+	if !found {
+		return
+	}
+	h.release(userID, st)
+	if last {
+		presenceChanged(userID)
+	}
+}
+
+// online проверяет, есть ли у пользователя подписчики
+func (h *Hub) online(userID int) bool {
+	h.mu.Lock()
+	st, ok := h.users[userID]
+	h.mu.Unlock()
+	if !ok {
+		return false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return len(st.subs) > 0
+}
+
+// onlineUsers возвращает пользователей, у которых есть подписчики
+func (h *Hub) onlineUsers() []int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	userIDs := make([]int, 0, len(h.users))
+	for userID := range h.users {
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs
+}
+
+// deliverLogged доставляет подписчикам пользователя событие, уже записанное
+// в его журнал. События приходят после фиксации из разных запросов и могут
+// обгонять друг друга: при разрыве недостающее досылается из журнала,
+// а уже отправленное пропускается.
+func (h *Hub) deliverLogged(userID int, env envelope) {
+	h.mu.Lock()
+	st, ok := h.users[userID]
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for s, pts := range st.subs {
+		switch {
+		case env.Pts <= pts:
+		case env.Pts == pts+1:
+			s.deliver(env)
+			st.subs[s] = env.Pts
+		default:
+			st.subs[s] = h.replay(userID, s, pts)
+		}
+	}
+}
+
+// deliver доставляет событие подписчикам пользователя, не записывая его в журнал
+func (h *Hub) deliver(userID int, env envelope) {
+	h.mu.Lock()
+	st, ok := h.users[userID]
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for s := range st.subs {
+		s.deliver(env)
+	}
+}
+
+// newEnvelope сериализует событие для доставки
+func newEnvelope(ev Event) envelope {
+	frame, _ := json.Marshal(ev)
+	return envelope{Pts: ev.Pts, Type: ev.Type, Frame: frame}
+}
+
+// SendEphemeral рассылает событие подключенным пользователям без записи
+// в журнал: у него нет pts, и после переподключения оно не досылается
+func SendEphemeral(userIDs []int, ev Event) {
+	ev.Pts = 0
+	env := newEnvelope(ev)
+	for _, userID := range userIDs {
+		hub.deliver(userID, env)
+	}
+}
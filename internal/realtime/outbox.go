@@ -0,0 +1,82 @@
+package realtime
+
+import (
+	"encoding/json"
+	"slices"
+	"messenger/internal/updates"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Outbox накапливает события изменения до его фиксации. Flush записывает их
+// в журналы получателей в транзакции изменения, поэтому изменение и запись
+// о нем фиксируются вместе; Send доставляет их после фиксации.
+type Outbox struct {
+	events []loggedEvent
+}
+
+// loggedEvent — событие для нескольких получателей и выданные им pts
+type loggedEvent struct {
+	userIDs []int
+	ev      Event
+	data    json.RawMessage
+	pts     map[int]int64
+}
+
+// Add ставит событие в очередь для пользователей
+func (o *Outbox) Add(userIDs []int, ev Event) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(ev.Data)
+	if err != nil {
+		return err
+	}
+	ids := slices.Clone(userIDs)
+	slices.Sort(ids)
+	o.events = append(o.events, loggedEvent{userIDs: slices.Compact(ids), ev: ev, data: data})
+	return nil
+}
+
+// Flush записывает события в журналы получателей. Строки всех получателей
+// блокируются заранее одним запросом, чтобы изменения с общими получателями
+// не заблокировали друг друга.
+func (o *Outbox) Flush(tx *sqlx.Tx) error {
+	if len(o.events) == 0 {
+		return nil
+	}
+	var all []int
+	for _, e := range o.events {
+		all = append(all, e.userIDs...)
+	}
+	if err := updates.LockUsers(tx, all); err != nil {
+		return err
+	}
+	for i := range o.events {
+		e := &o.events[i]
+		pts, err := updates.AppendMany(tx, e.userIDs, e.ev.Type, e.ev.ChatID, e.data)
+		if err != nil {
+			return err
+		}
+		e.pts = pts
+	}
+	return nil
+}
+
+// Send доставляет записанные события подключенным получателям. Остальные
+// получат их из журнала при подключении.
+func (o *Outbox) Send() {
+	for _, e := range o.events {
+		ev := e.ev
+		ev.Data = e.data
+		for _, userID := range e.userIDs {
+			pts, ok := e.pts[userID]
+			if !ok {
+				continue
+			}
+			ev.Pts = pts
+			hub.deliverLogged(userID, newEnvelope(ev))
+		}
+	}
+	o.events = nil
+}
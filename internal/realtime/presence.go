@@ -0,0 +1,29 @@
+package realtime
+
+// PresenceHandler вызывается, когда у пользователя появляется первое подключение
+// или закрывается последнее. Актуальный статус нужно проверять через IsOnline:
+// вызовы для одного пользователя могут идти одновременно.
+type PresenceHandler func(userID int)
+
+var presenceHandler PresenceHandler
+
+// SetPresenceHandler задает обработчик смены сетевого статуса
+func SetPresenceHandler(handler PresenceHandler) {
+	presenceHandler = handler
+}
+
+// IsOnline проверяет, есть ли у пользователя активные подключения
+func IsOnline(userID int) bool {
+	return hub.online(userID)
+}
+
+// OnlineUsers возвращает пользователей, у которых есть активные подключения
+func OnlineUsers() []int {
+	return hub.onlineUsers()
+}
+
+func presenceChanged(userID int) {
+	if presenceHandler != nil {
+		presenceHandler(userID)
+	}
+}
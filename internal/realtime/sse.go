@@ -0,0 +1,96 @@
+package realtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Как часто в SSE-поток пишется комментарий, чтобы прокси не закрывали соединение
+const sseHeartbeatPeriod = 25 * time.Second
+
+// stream — подписка на события пользователя для Server-Sent Events
+type stream struct {
+	events chan envelope
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// hello реализует subscriber. Событие hello задает EventSource начальный
+// Last-Event-ID, чтобы после обрыва он получил все пропущенное.
+func (s *stream) hello(pts int64) {
+	frame, _ := json.Marshal(Event{Pts: pts, Type: EventHello})
+	s.deliver(envelope{Pts: pts, Type: EventHello, Frame: frame})
+}
+
+// deliver реализует subscriber
+func (s *stream) deliver(env envelope) {
+	select {
+	case <-s.done:
+	case s.events <- env:
+	default:
+		// Клиент не успевает читать: закрываем поток, он переподключится
+		// с Last-Event-ID и получит пропущенное
+		s.close()
+	}
+}
+
+func (s *stream) close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+// ServeSSE отдает события пользователя в формате text/event-stream, пока клиент
+// не отключится. ID события — его pts, поэтому события после lastEventID
+// досылаются из журнала обновлений.
+func ServeSSE(w http.ResponseWriter, r *http.Request, userID int, lastEventID int64) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	// Подсказываем EventSource, через сколько переподключаться
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	s := &stream{
+		events: make(chan envelope, sendBufferSize),
+		done:   make(chan struct{}),
+	}
+	hub.subscribe(userID, s, lastEventID)
+	defer hub.unsubscribe(userID, s)
+
+	heartbeat := time.NewTicker(sseHeartbeatPeriod)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case env := <-s.events:
+			// У событий вне журнала нет id, иначе EventSource сбросит Last-Event-ID
+			if env.Pts > 0 {
+				if _, err := fmt.Fprintf(w, "id: %d\n", env.Pts); err != nil {
+					return
+				}
+			}
+			_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", env.Type, env.Frame)
+			if err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
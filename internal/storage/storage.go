@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrNotFound возвращается, если объекта с таким ключом нет
+var ErrNotFound = errors.New("object not found")
+
+// Storage хранит содержимое вложений по ключу
+type Storage interface {
+	// Put сохраняет объект размером size байт
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get открывает объект для чтения
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete удаляет объект; отсутствие объекта ошибкой не считается
+	Delete(ctx context.Context, key string) error
+}
+
+// Files — хранилище вложений, выбранное при запуске
+var Files Storage
+
+// Init выбирает хранилище по STORAGE_DRIVER: local (по умолчанию) хранит файлы
+// в каталоге STORAGE_DIR, s3 — в S3-совместимом хранилище, например MinIO
+func Init() error {
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "local":
+		dir := os.Getenv("STORAGE_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		local, err := NewLocal(dir)
+		if err != nil {
+			return err
+		}
+		Files = local
+	case "s3":
+		s3, err := NewS3(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    os.Getenv("S3_REGION"),
+			UseSSL:    os.Getenv("S3_USE_SSL") == "true",
+		})
+		if err != nil {
+			return err
+		}
+		Files = s3
+	default:
+		return fmt.Errorf("unknown storage driver: %s", driver)
+	}
+	return nil
+}
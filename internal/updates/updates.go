@@ -0,0 +1,157 @@
+package updates
+
+import (
+	"encoding/json"
+	"time"
+	"messenger/internal/db"
+	"messenger/internal/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// DifferenceLimit — сколько обновлений максимум отдается за один раз.
+// Если клиент отстал сильнее, ему нужно загрузить состояние заново.
+const DifferenceLimit = 1000
+
+// DefaultRetention — сколько по умолчанию хранятся записи журналов
+const DefaultRetention = 7 * 24 * time.Hour
+
+// Difference представляет обновления, пропущенные клиентом
+type Difference struct {
+	Updates []models.Update `json:"updates"`
+	Pts     int64           `json:"pts"`      // текущее состояние пользователя или канала
+	TooLong bool            `json:"too_long"` // разрыв слишком большой, нужен полный ресинк
+}
+
+// LockUsers блокирует строки пользователей до конца транзакции. Строки
+// берутся в порядке ID, поэтому параллельные изменения с общими
+// получателями не блокируют друг друга взаимно.
+func LockUsers(tx *sqlx.Tx, userIDs []int) error {
+	_, err := tx.Exec("SELECT 1 FROM users WHERE id = ANY($1) ORDER BY id FOR NO KEY UPDATE", int64Array(userIDs))
+	return err
+}
+
+// AppendMany добавляет одну и ту же запись в журналы пользователей в транзакции
+// изменения и возвращает pts записи для каждого из них. Блокировка строки
+// пользователя до фиксации гарантирует, что pts выдаются и фиксируются по порядку.
+func AppendMany(tx *sqlx.Tx, userIDs []int, updateType string, chatID int, data json.RawMessage) (map[int]int64, error) {
+	var rows []struct {
+		UserID int   `db:"user_id"`
+		Pts    int64 `db:"pts"`
+	}
+	err := tx.Select(&rows, `
+		WITH bumped AS (
+			UPDATE users SET pts = pts + 1 WHERE id = ANY($1)
+			RETURNING id, pts
+		)
+		INSERT INTO updates (user_id, pts, type, chat_id, data)
+		SELECT id, pts, $2::text, $3::int, $4::jsonb FROM bumped
+		RETURNING user_id, pts
+	`, int64Array(userIDs), updateType, chatID, []byte(data))
+	if err != nil {
+		return nil, err
+	}
+	pts := make(map[int]int64, len(rows))
+	for _, row := range rows {
+		pts[row.UserID] = row.Pts
+	}
+	return pts, nil
+}
+
+// int64Array передает ID массивом PostgreSQL
+func int64Array(ids []int) interface{} {
+	values := make([]int64, len(ids))
+	for i, id := range ids {
+		values[i] = int64(id)
+	}
+	return pq.Array(values)
+}
+
+// CurrentPts возвращает текущее состояние пользователя
+func CurrentPts(userID int) (int64, error) {
+	var pts int64
+	err := db.DB.Get(&pts, "SELECT pts FROM users WHERE id=$1", userID)
+	return pts, err
+}
+
+// GetDifference возвращает обновления пользователя после since
+func GetDifference(userID int, since int64) (*Difference, error) {
+	pts, err := CurrentPts(userID)
+	if err != nil {
+		return nil, err
+	}
+	return difference(pts, since, `
+		SELECT pts, type, chat_id, data, created_at FROM updates
+		WHERE user_id = $1 AND pts > $2
+		ORDER BY pts
+		LIMIT $3
+	`, userID)
+}
+
+// AppendChannel добавляет запись в журнал канала и возвращает ее pts.
+// Строка канала блокируется до фиксации, поэтому pts выдаются
+// и фиксируются по порядку.
+func AppendChannel(tx *sqlx.Tx, chatID int, updateType string, data json.RawMessage) (int64, error) {
+	var pts int64
+	err := tx.Get(&pts, `
+		WITH bumped AS (
+			UPDATE chats SET pts = pts + 1 WHERE id = $1
+			RETURNING id, pts
+		)
+		INSERT INTO channel_updates (chat_id, pts, type, data)
+		SELECT id, pts, $2::text, $3::jsonb FROM bumped
+		RETURNING pts
+	`, chatID, updateType, []byte(data))
+	return pts, err
+}
+
+// GetChannelDifference возвращает обновления канала после since
+func GetChannelDifference(chatID int, since int64) (*Difference, error) {
+	var pts int64
+	if err := db.DB.Get(&pts, "SELECT pts FROM chats WHERE id=$1", chatID); err != nil {
+		return nil, err
+	}
+	return difference(pts, since, `
+		SELECT pts, type, chat_id, data, created_at FROM channel_updates
+		WHERE chat_id = $1 AND pts > $2
+		ORDER BY pts
+		LIMIT $3
+	`, chatID)
+}
+
+// difference выбирает записи журнала после since запросом query
+// ($1 — владелец журнала, $2 — since, $3 — лимит); pts — текущее состояние
+func difference(pts, since int64, query string, ownerID int) (*Difference, error) {
+	diff := &Difference{Updates: []models.Update{}, Pts: pts}
+	if since == pts {
+		return diff, nil
+	}
+	// Клиент знает о состоянии, которого у нас нет, или отстал слишком сильно
+	if since > pts || pts-since > DifferenceLimit {
+		diff.TooLong = true
+		return diff, nil
+	}
+	if err := db.DB.Select(&diff.Updates, query, ownerID, since, DifferenceLimit); err != nil {
+		return nil, err
+	}
+	// Часть журнала могла быть удалена, тогда восстановить разрыв нельзя
+	if len(diff.Updates) == 0 || diff.Updates[0].Pts != since+1 {
+		diff.Updates = []models.Update{}
+		diff.TooLong = true
+	}
+	return diff, nil
+}
+
+// Prune удаляет из журналов пользователей и каналов записи старше retention.
+// Клиенты, отставшие сильнее, получают TooLong и загружают состояние заново.
+func Prune(retention time.Duration) error {
+	for _, table := range []string{"updates", "channel_updates"} {
+		_, err := db.DB.Exec("DELETE FROM "+table+" WHERE created_at < now() - $1::float8 * interval '1 second'",
+			retention.Seconds())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
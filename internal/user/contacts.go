@@ -35,7 +35,7 @@ func AddContact(userID, contactID int) error {
 	return err
 }
 
-// GetContacts получает список контактов пользователя
+// GetContacts получает список контактов пользователя вместе с их статусом присутствия
 func GetContacts(userID int) ([]models.User, error) {
 	var contacts []models.User
 	err := db.DB.Select(&contacts, `
@@ -44,5 +44,15 @@ func GetContacts(userID int) ([]models.User, error) {
 		WHERE c.user_id = $1
 		ORDER BY u.username
 	`, userID)
-	return contacts, err
+	if err != nil {
+		return nil, err
+	}
+	pointers := make([]*models.User, len(contacts))
+	for i := range contacts {
+		pointers[i] = &contacts[i]
+	}
+	if err := AttachPresence(userID, pointers); err != nil {
+		return nil, err
+	}
+	return contacts, nil
 }
@@ -0,0 +1,233 @@
+package user
+
+import (
+	"log"
+	"sync"
+	"time"
+	"messenger/internal/db"
+	"messenger/internal/models"
+	"messenger/internal/realtime"
+
+	"github.com/lib/pq"
+)
+
+// Значения статуса присутствия
+const (
+	PresenceOnline      = "online"
+	PresenceOffline     = "offline"
+	PresenceRecently    = "recently"
+	PresenceWithinWeek  = "within_week"
+	PresenceWithinMonth = "within_month"
+	PresenceLongAgo     = "long_ago"
+)
+
+const (
+	// Пользователь без открытого соединения считается в сети
+	// еще столько времени после последнего запроса к API
+	OnlineTimeout = 5 * time.Minute
+	// Не чаще одной записи last_seen_at на пользователя за этот интервал
+	touchInterval = time.Minute
+)
+
+// presenceUpdated — данные события о смене статуса
+type presenceUpdated struct {
+	UserID   int              `json:"user_id"`
+	Presence *models.Presence `json:"presence"`
+}
+
+// touchLimiter помнит время последней записи last_seen_at пользователя
+var touchLimiter = struct {
+	sync.Mutex
+	last map[int]time.Time
+}{last: make(map[int]time.Time)}
+
+// Touch отмечает активность пользователя в API. Запись в базу
+// выполняется не чаще раза в touchInterval.
+func Touch(userID int) {
+	now := time.Now()
+	touchLimiter.Lock()
+	if last, ok := touchLimiter.last[userID]; ok && now.Sub(last) < touchInterval {
+		touchLimiter.Unlock()
+		return
+	}
+	touchLimiter.last[userID] = now
+	if len(touchLimiter.last) > 10000 {
+		for id, t := range touchLimiter.last {
+			if now.Sub(t) > touchInterval {
+				delete(touchLimiter.last, id)
+			}
+		}
+	}
+	touchLimiter.Unlock()
+	if _, err := db.DB.Exec("UPDATE users SET last_seen_at=now() WHERE id=$1", userID); err != nil {
+		log.Printf("presence: touch user %d: %v", userID, err)
+	}
+}
+
+// HandlePresence вызывается при первом подключении пользователя и при закрытии
+// последнего: сохраняет время активности и рассылает новый статус тем,
+// у кого пользователь в контактах.
+func HandlePresence(userID int) {
+	if _, err := db.DB.Exec("UPDATE users SET last_seen_at=now() WHERE id=$1", userID); err != nil {
+		log.Printf("presence: update user %d: %v", userID, err)
+		return
+	}
+	var watchers []struct {
+		UserID int  `db:"user_id"`
+		Mutual bool `db:"mutual"` // пользователь тоже держит наблюдателя в контактах
+	}
+	err := db.DB.Select(&watchers, `
+		SELECT c.user_id, EXISTS (
+			SELECT 1 FROM contacts r WHERE r.user_id = $1 AND r.contact_id = c.user_id
+		) AS mutual
+		FROM contacts c WHERE c.contact_id = $1
+	`, userID)
+	if err != nil || len(watchers) == 0 {
+		if err != nil {
+			log.Printf("presence: watchers of user %d: %v", userID, err)
+		}
+		return
+	}
+	rows, err := loadPresenceFor(0, []int{userID})
+	if err != nil || len(rows) == 0 {
+		if err != nil {
+			log.Printf("presence: load user %d: %v", userID, err)
+		}
+		return
+	}
+	row := rows[0]
+	// После закрытия последнего подключения last_seen_at только что обновлен,
+	// и без этого флага пользователь остался бы в сети еще OnlineTimeout
+	row.Disconnected = !row.Connected
+	// Наблюдателей делим на тех, кому видно точное время, и остальных
+	var exact, rough []int
+	for _, w := range watchers {
+		if row.visibleTo(w.UserID, w.Mutual) {
+			exact = append(exact, w.UserID)
+		} else {
+			rough = append(rough, w.UserID)
+		}
+	}
+	if len(exact) > 0 {
+		realtime.SendEphemeral(exact, realtime.Event{Type: realtime.EventPresence,
+			Data: presenceUpdated{UserID: userID, Presence: row.exact()}})
+	}
+	if len(rough) > 0 {
+		realtime.SendEphemeral(rough, realtime.Event{Type: realtime.EventPresence,
+			Data: presenceUpdated{UserID: userID, Presence: row.rough()}})
+	}
+}
+
+// AttachPresence заполняет статус присутствия пользователей
+// с точки зрения viewerID с учетом их настроек приватности
+func AttachPresence(viewerID int, users []*models.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+	ids := make([]int, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	rows, err := loadPresenceFor(viewerID, ids)
+	if err != nil {
+		return err
+	}
+	byID := make(map[int]presenceRow, len(rows))
+	for _, row := range rows {
+		byID[row.ID] = row
+	}
+	for _, u := range users {
+		row, ok := byID[u.ID]
+		if !ok {
+			continue
+		}
+		if row.visibleTo(viewerID, row.IsContact) {
+			u.Presence = row.exact()
+		} else {
+			u.Presence = row.rough()
+		}
+	}
+	return nil
+}
+
+// presenceRow — данные о присутствии пользователя из базы
+type presenceRow struct {
+	ID         int        `db:"id"`
+	LastSeenAt *time.Time `db:"last_seen_at"`
+	Privacy    string     `db:"last_seen_privacy"`
+	Age        *float64   `db:"age"`        // секунд с последней активности
+	IsContact  bool       `db:"is_contact"` // у пользователя в контактах есть запросивший
+
+	Connected    bool `db:"-"` // есть открытое подключение
+	Disconnected bool `db:"-"` // последнее подключение только что закрыто
+}
+
+// loadPresenceFor выбирает данные о присутствии; is_contact считается для viewerID
+func loadPresenceFor(viewerID int, ids []int) ([]presenceRow, error) {
+	var rows []presenceRow
+	err := db.DB.Select(&rows, `
+		SELECT u.id, u.last_seen_at, u.last_seen_privacy,
+			EXTRACT(EPOCH FROM now() - u.last_seen_at) AS age,
+			EXISTS (
+				SELECT 1 FROM contacts c WHERE c.user_id = u.id AND c.contact_id = $1
+			) AS is_contact
+		FROM users u WHERE u.id = ANY($2)
+	`, viewerID, pq.Array(ids))
+	for i := range rows {
+		rows[i].Connected = realtime.IsOnline(rows[i].ID)
+	}
+	return rows, err
+}
+
+// visibleTo проверяет, видно ли viewerID точное время активности
+func (p presenceRow) visibleTo(viewerID int, isContact bool) bool {
+	if viewerID == p.ID {
+		return true
+	}
+	switch p.Privacy {
+	case LastSeenEverybody:
+		return true
+	case LastSeenContacts:
+		return isContact
+	}
+	return false
+}
+
+func (p presenceRow) online() bool {
+	if p.Connected {
+		return true
+	}
+	if p.Disconnected {
+		return false
+	}
+	return p.Age != nil && *p.Age < OnlineTimeout.Seconds()
+}
+
+// exact возвращает точный статус
+func (p presenceRow) exact() *models.Presence {
+	if p.online() {
+		return &models.Presence{Status: PresenceOnline}
+	}
+	if p.LastSeenAt == nil {
+		return &models.Presence{Status: PresenceLongAgo}
+	}
+	return &models.Presence{Status: PresenceOffline, LastSeenAt: p.LastSeenAt}
+}
+
+// rough возвращает приблизительный статус; факт нахождения в сети тоже скрывается
+func (p presenceRow) rough() *models.Presence {
+	const day = 24 * time.Hour
+	switch {
+	case p.online():
+		return &models.Presence{Status: PresenceRecently}
+	case p.Age == nil:
+		return &models.Presence{Status: PresenceLongAgo}
+	case *p.Age <= (3 * day).Seconds():
+		return &models.Presence{Status: PresenceRecently}
+	case *p.Age <= (7 * day).Seconds():
+		return &models.Presence{Status: PresenceWithinWeek}
+	case *p.Age <= (30 * day).Seconds():
+		return &models.Presence{Status: PresenceWithinMonth}
+	}
+	return &models.Presence{Status: PresenceLongAgo}
+}
@@ -0,0 +1,74 @@
+package user
+
+import (
+	"testing"
+	"time"
+)
+
+func ago(d time.Duration) *float64 {
+	age := d.Seconds()
+	return &age
+}
+
+func TestPresenceRowStatus(t *testing.T) {
+	seen := time.Now()
+	tests := []struct {
+		name  string
+		row   presenceRow
+		exact string
+		rough string
+	}{
+		{"connected", presenceRow{Connected: true, LastSeenAt: &seen, Age: ago(time.Hour)}, PresenceOnline, PresenceRecently},
+		{"active via api", presenceRow{LastSeenAt: &seen, Age: ago(time.Minute)}, PresenceOnline, PresenceRecently},
+		{"just disconnected", presenceRow{Disconnected: true, LastSeenAt: &seen, Age: ago(0)}, PresenceOffline, PresenceRecently},
+		{"online timeout passed", presenceRow{LastSeenAt: &seen, Age: ago(OnlineTimeout + time.Second)}, PresenceOffline, PresenceRecently},
+		{"two days", presenceRow{LastSeenAt: &seen, Age: ago(48 * time.Hour)}, PresenceOffline, PresenceRecently},
+		{"five days", presenceRow{LastSeenAt: &seen, Age: ago(5 * 24 * time.Hour)}, PresenceOffline, PresenceWithinWeek},
+		{"two weeks", presenceRow{LastSeenAt: &seen, Age: ago(14 * 24 * time.Hour)}, PresenceOffline, PresenceWithinMonth},
+		{"two months", presenceRow{LastSeenAt: &seen, Age: ago(60 * 24 * time.Hour)}, PresenceOffline, PresenceLongAgo},
+		{"never seen", presenceRow{}, PresenceLongAgo, PresenceLongAgo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.row.exact().Status; got != tt.exact {
+				t.Errorf("exact() = %q, want %q", got, tt.exact)
+			}
+			if got := tt.row.rough(); got.Status != tt.rough || got.LastSeenAt != nil {
+				t.Errorf("rough() = %+v, want status %q without time", got, tt.rough)
+			}
+		})
+	}
+}
+
+func TestPresenceRowExactLastSeen(t *testing.T) {
+	seen := time.Now()
+	row := presenceRow{Disconnected: true, LastSeenAt: &seen, Age: ago(0)}
+	if got := row.exact().LastSeenAt; got == nil || !got.Equal(seen) {
+		t.Errorf("exact().LastSeenAt = %v, want %v", got, seen)
+	}
+	row = presenceRow{Connected: true, LastSeenAt: &seen}
+	if got := row.exact().LastSeenAt; got != nil {
+		t.Errorf("online exact().LastSeenAt = %v, want nil", got)
+	}
+}
+
+func TestPresenceRowVisibleTo(t *testing.T) {
+	tests := []struct {
+		privacy   string
+		viewerID  int
+		isContact bool
+		want      bool
+	}{
+		{LastSeenEverybody, 2, false, true},
+		{LastSeenContacts, 2, true, true},
+		{LastSeenContacts, 2, false, false},
+		{LastSeenNobody, 2, true, false},
+		{LastSeenNobody, 1, false, true}, // свой статус виден всегда
+	}
+	for _, tt := range tests {
+		row := presenceRow{ID: 1, Privacy: tt.privacy}
+		if got := row.visibleTo(tt.viewerID, tt.isContact); got != tt.want {
+			t.Errorf("visibleTo(%d, %v) with %q = %v, want %v", tt.viewerID, tt.isContact, tt.privacy, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package user
+
+import (
+	"errors"
+	"messenger/internal/db"
+	"messenger/internal/models"
+)
+
+// Кому видно точное время последней активности
+const (
+	LastSeenEverybody = "everybody"
+	LastSeenContacts  = "contacts" // только тем, кто есть в контактах пользователя
+	LastSeenNobody    = "nobody"
+)
+
+// GetPrivacySettings получает настройки приватности пользователя
+func GetPrivacySettings(userID int) (*models.PrivacySettings, error) {
+	var settings models.PrivacySettings
+	err := db.DB.Get(&settings, "SELECT show_read_receipts, last_seen_privacy FROM users WHERE id=$1", userID)
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// UpdatePrivacySettings сохраняет настройки приватности пользователя
+func UpdatePrivacySettings(userID int, settings models.PrivacySettings) error {
+	switch settings.LastSeen {
+	case LastSeenEverybody, LastSeenContacts, LastSeenNobody:
+	default:
+		return errors.New("invalid last_seen value")
+	}
+	_, err := db.DB.Exec("UPDATE users SET show_read_receipts=$1, last_seen_privacy=$2 WHERE id=$3",
+		settings.ShowReadReceipts, settings.LastSeen, userID)
+	return err
+}
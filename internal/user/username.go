@@ -0,0 +1,66 @@
+package user
+
+import (
+	"errors"
+	"messenger/internal/db"
+	"messenger/internal/models"
+	"messenger/internal/utils"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrUsernameTaken возвращается, если имя уже занято пользователем или чатом
+var ErrUsernameTaken = errors.New("username is already taken")
+
+// MaxSearchResults — сколько результатов каждого вида возвращает поиск
+const MaxSearchResults = 20
+
+// ClaimUsername закрепляет имя в общем пространстве имен пользователей и чатов.
+// Владелец — пользователь userID или чат chatID; второй аргумент равен нулю.
+func ClaimUsername(tx *sqlx.Tx, username string, userID, chatID int) error {
+	var ownerUserID, ownerChatID *int
+	if userID != 0 {
+		ownerUserID = &userID
+	} else {
+		ownerChatID = &chatID
+	}
+	result, err := tx.Exec(`
+		INSERT INTO usernames (name, user_id, chat_id) VALUES (lower($1), $2, $3)
+		ON CONFLICT DO NOTHING
+	`, username, ownerUserID, ownerChatID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUsernameTaken
+	}
+	return nil
+}
+
+// ReleaseChatUsername освобождает имя чата
+func ReleaseChatUsername(tx *sqlx.Tx, chatID int) error {
+	_, err := tx.Exec("DELETE FROM usernames WHERE chat_id=$1", chatID)
+	return err
+}
+
+// SearchUsers ищет пользователей по началу имени
+func SearchUsers(viewerID int, query string) ([]models.User, error) {
+	var users []models.User
+	err := db.DB.Select(&users, `
+		SELECT id, username FROM users
+		WHERE lower(username) LIKE $1
+		ORDER BY length(username), username
+		LIMIT $2
+	`, utils.LikePrefix(query), MaxSearchResults)
+	if err != nil {
+		return nil, err
+	}
+	pointers := make([]*models.User, len(users))
+	for i := range users {
+		pointers[i] = &users[i]
+	}
+	if err := AttachPresence(viewerID, pointers); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
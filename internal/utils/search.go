@@ -0,0 +1,10 @@
+package utils
+
+import "strings"
+
+// LikePrefix превращает поисковый запрос в шаблон LIKE для поиска
+// по началу строки без учета регистра; спецсимволы LIKE экранируются
+func LikePrefix(query string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(strings.ToLower(query)) + "%"
+}
@@ -0,0 +1,13 @@
+-- Последовательность обновлений пользователя (pts)
+ALTER TABLE users ADD COLUMN pts BIGINT NOT NULL DEFAULT 0;
+
+-- updates: журнал обновлений каждого пользователя
+CREATE TABLE updates (
+    user_id INT NOT NULL,
+    pts BIGINT NOT NULL,
+    type TEXT NOT NULL,
+    chat_id INT NOT NULL DEFAULT 0,
+    data JSONB,
+    created_at TIMESTAMP DEFAULT now(),
+    PRIMARY KEY (user_id, pts)
+);
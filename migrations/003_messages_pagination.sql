@@ -0,0 +1,2 @@
+-- Постраничная выборка сообщений идет по (chat_id, id)
+CREATE INDEX messages_chat_id_idx ON messages (chat_id, id);
@@ -0,0 +1,11 @@
+-- Время последнего редактирования сообщения
+ALTER TABLE messages ADD COLUMN edited_at TIMESTAMP;
+
+-- message_edits: предыдущие версии отредактированных сообщений
+CREATE TABLE message_edits (
+    id SERIAL PRIMARY KEY,
+    message_id INT NOT NULL,
+    text TEXT NOT NULL,
+    edited_at TIMESTAMP DEFAULT now()
+);
+CREATE INDEX message_edits_message_id_idx ON message_edits (message_id);
@@ -0,0 +1,12 @@
+-- Сообщения, удаленные для всех, остаются в чате как пустые записи
+ALTER TABLE messages ADD COLUMN deleted_at TIMESTAMP;
+
+-- message_hidden: сообщения, удаленные пользователем только у себя
+CREATE TABLE message_hidden (
+    message_id INT,
+    user_id INT,
+    PRIMARY KEY (message_id, user_id)
+);
+
+-- Роль участника чата: создатель группы становится администратором
+ALTER TABLE chat_members ADD COLUMN role TEXT NOT NULL DEFAULT 'member';
@@ -0,0 +1,2 @@
+-- Ответ на сообщение того же чата
+ALTER TABLE messages ADD COLUMN reply_to_message_id INT;
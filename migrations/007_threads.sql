@@ -0,0 +1,14 @@
+-- Ветки обсуждений: ответы хранят корневое сообщение,
+-- корень хранит число ответов и время последнего
+ALTER TABLE messages ADD COLUMN thread_root_id INT;
+ALTER TABLE messages ADD COLUMN thread_reply_count INT NOT NULL DEFAULT 0;
+ALTER TABLE messages ADD COLUMN thread_last_reply_at TIMESTAMP;
+CREATE INDEX messages_thread_root_id_idx ON messages (thread_root_id, id);
+
+-- thread_followers: подписки на ветки и позиция прочтения
+CREATE TABLE thread_followers (
+    root_message_id INT,
+    user_id INT,
+    last_read_message_id INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (root_message_id, user_id)
+);
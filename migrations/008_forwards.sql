@@ -0,0 +1,4 @@
+-- Пересланные сообщения хранят автора, чат и время оригинала
+ALTER TABLE messages ADD COLUMN forwarded_from_user_id INT;
+ALTER TABLE messages ADD COLUMN forwarded_from_chat_id INT;
+ALTER TABLE messages ADD COLUMN forwarded_from_sent_at TIMESTAMP;
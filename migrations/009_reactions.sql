@@ -0,0 +1,11 @@
+-- message_reactions: реакции участников на сообщения
+CREATE TABLE message_reactions (
+    message_id INT,
+    user_id INT,
+    emoji TEXT,
+    created_at TIMESTAMP DEFAULT now(),
+    PRIMARY KEY (message_id, user_id, emoji)
+);
+
+-- Разрешенные в чате реакции; NULL — любые
+ALTER TABLE chats ADD COLUMN allowed_reactions TEXT[];
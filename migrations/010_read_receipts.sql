@@ -0,0 +1,5 @@
+-- Позиция прочтения участника чата
+ALTER TABLE chat_members ADD COLUMN last_read_message_id INT NOT NULL DEFAULT 0;
+
+-- Настройка приватности: показывать ли собеседнику, что сообщения прочитаны
+ALTER TABLE users ADD COLUMN show_read_receipts BOOLEAN NOT NULL DEFAULT TRUE;
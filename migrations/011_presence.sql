@@ -0,0 +1,5 @@
+-- Время последней активности пользователя
+ALTER TABLE users ADD COLUMN last_seen_at TIMESTAMP;
+
+-- Кому показывать точное время последней активности: everybody, contacts, nobody
+ALTER TABLE users ADD COLUMN last_seen_privacy TEXT NOT NULL DEFAULT 'everybody';
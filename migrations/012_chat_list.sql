@@ -0,0 +1,2 @@
+-- Время создания чата: по нему сортируются чаты без сообщений
+ALTER TABLE chats ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT now();
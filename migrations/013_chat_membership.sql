@@ -0,0 +1,2 @@
+-- Служебные сообщения о событиях чата ("Alice added Bob"): тип и участники события
+ALTER TABLE messages ADD COLUMN action JSONB;
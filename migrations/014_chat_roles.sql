@@ -0,0 +1,6 @@
+-- Роли участников: owner, admin, member. Создатели групп становятся владельцами
+UPDATE chat_members SET role = 'owner' WHERE role = 'admin';
+
+-- Права администратора: change_info, delete_messages, ban_users,
+-- invite_users, pin_messages, add_admins
+ALTER TABLE chat_members ADD COLUMN permissions TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+-- Описание и фото группы
+ALTER TABLE chats ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE chats ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '';
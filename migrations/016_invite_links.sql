@@ -0,0 +1,31 @@
+-- chat_invite_links: ссылки-приглашения в группы
+CREATE TABLE chat_invite_links (
+    id SERIAL PRIMARY KEY,
+    chat_id INT NOT NULL,
+    token TEXT UNIQUE NOT NULL,
+    creator_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    expires_at TIMESTAMP,             -- NULL — бессрочная
+    max_uses INT,                     -- NULL — без ограничения
+    uses INT NOT NULL DEFAULT 0,
+    requires_approval BOOLEAN NOT NULL DEFAULT FALSE,
+    revoked_at TIMESTAMP
+);
+CREATE INDEX chat_invite_links_chat_id_idx ON chat_invite_links (chat_id);
+
+-- chat_invite_joins: кто и когда вступил по ссылке
+CREATE TABLE chat_invite_joins (
+    link_id INT,
+    user_id INT,
+    joined_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (link_id, user_id)
+);
+
+-- chat_join_requests: заявки на вступление, ожидающие одобрения администратора
+CREATE TABLE chat_join_requests (
+    chat_id INT,
+    user_id INT,
+    link_id INT NOT NULL,
+    requested_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (chat_id, user_id)
+);
@@ -0,0 +1,19 @@
+-- Тип чата: private, group или channel. is_group остается для совместимости
+-- и равен true для всех чатов, кроме личных
+ALTER TABLE chats ADD COLUMN type TEXT NOT NULL DEFAULT 'private';
+UPDATE chats SET type = 'group' WHERE is_group;
+
+-- Публичное имя чата: по нему можно найти канал и вступить в него
+ALTER TABLE chats ADD COLUMN username TEXT;
+CREATE UNIQUE INDEX chats_username_idx ON chats (lower(username));
+
+-- Посты каналов подписываются каналом, а не администратором
+ALTER TABLE messages ADD COLUMN sender_chat_id INT;
+
+-- Счетчик просмотров постов и уникальные просмотры
+ALTER TABLE messages ADD COLUMN view_count INT NOT NULL DEFAULT 0;
+CREATE TABLE message_views (
+    message_id INT,
+    user_id INT,
+    PRIMARY KEY (message_id, user_id)
+);
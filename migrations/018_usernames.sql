@@ -0,0 +1,39 @@
+-- usernames: общее пространство имен пользователей и публичных чатов.
+-- Имя хранится в нижнем регистре и принадлежит либо пользователю, либо чату.
+CREATE TABLE usernames (
+    name TEXT PRIMARY KEY,
+    user_id INT UNIQUE,
+    chat_id INT UNIQUE
+);
+
+-- Имена пользователей, совпадающие без учета регистра, нужно развести
+-- вручную до миграции: молча переименовывать их нельзя, по имени входят
+DO $$
+DECLARE
+    dups TEXT;
+BEGIN
+    SELECT string_agg(name, ', ' ORDER BY name) INTO dups FROM (
+        SELECT lower(username) AS name FROM users GROUP BY 1 HAVING COUNT(*) > 1
+    ) d;
+    IF dups IS NOT NULL THEN
+        RAISE EXCEPTION 'usernames differ only in case: %', dups;
+    END IF;
+END $$;
+INSERT INTO usernames (name, user_id)
+SELECT lower(username), id FROM users;
+
+-- Имя чата, уже занятое пользователем или чатом с меньшим ID, освобождается;
+-- каждый такой чат перечисляется в выводе миграции
+DO $$
+DECLARE
+    c RECORD;
+BEGIN
+    FOR c IN SELECT id, username FROM chats WHERE username IS NOT NULL ORDER BY id LOOP
+        INSERT INTO usernames (name, chat_id) VALUES (lower(c.username), c.id)
+        ON CONFLICT DO NOTHING;
+        IF NOT FOUND THEN
+            RAISE NOTICE 'chat %: username "%" is already taken, cleared', c.id, c.username;
+            UPDATE chats SET username = NULL WHERE id = c.id;
+        END IF;
+    END LOOP;
+END $$;
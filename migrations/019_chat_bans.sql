@@ -0,0 +1,12 @@
+-- chat_bans: заблокированные пользователи не могут вернуться в группу
+-- ни по ссылке-приглашению, ни по публичному имени
+CREATE TABLE chat_bans (
+    chat_id INT NOT NULL,
+    user_id INT NOT NULL,
+    banned_by INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (chat_id, user_id)
+);
+
+-- Участник только читает чат до указанного времени
+ALTER TABLE chat_members ADD COLUMN restricted_until TIMESTAMP;
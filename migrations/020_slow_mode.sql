@@ -0,0 +1,7 @@
+-- Медленный режим: участник группы пишет не чаще раза в slow_mode_seconds; 0 — выключен
+ALTER TABLE chats ADD COLUMN slow_mode_seconds INT NOT NULL DEFAULT 0;
+
+-- Время последнего сообщения участника. Проверка и обновление идут
+-- под блокировкой строки участника, поэтому два одновременных
+-- сообщения не проходят оба.
+ALTER TABLE chat_members ADD COLUMN last_sent_at TIMESTAMP;
@@ -0,0 +1,8 @@
+-- pinned_messages: закрепленные сообщения чата; последнее закрепленное — первое
+CREATE TABLE pinned_messages (
+    chat_id INT NOT NULL,
+    message_id INT NOT NULL,
+    pinned_by INT NOT NULL,
+    pinned_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (chat_id, message_id)
+);
@@ -0,0 +1,20 @@
+-- attachments: загруженные файлы; содержимое лежит в хранилище под storage_key
+CREATE TABLE attachments (
+    id SERIAL PRIMARY KEY,
+    uploader_id INT NOT NULL,
+    storage_key TEXT UNIQUE NOT NULL,
+    filename TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- message_attachments: вложения сообщений в порядке position.
+-- Пересланные сообщения ссылаются на те же вложения
+CREATE TABLE message_attachments (
+    message_id INT NOT NULL,
+    attachment_id INT NOT NULL,
+    position INT NOT NULL,
+    PRIMARY KEY (message_id, attachment_id)
+);
+CREATE INDEX message_attachments_attachment_id_idx ON message_attachments (attachment_id);
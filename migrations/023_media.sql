@@ -0,0 +1,16 @@
+-- Сведения об изображениях: размеры с учетом ориентации и превью BlurHash
+ALTER TABLE attachments ADD COLUMN width INT NOT NULL DEFAULT 0;
+ALTER TABLE attachments ADD COLUMN height INT NOT NULL DEFAULT 0;
+ALTER TABLE attachments ADD COLUMN blurhash TEXT NOT NULL DEFAULT '';
+
+-- attachment_thumbnails: уменьшенные копии изображений в JPEG,
+-- max_side — наибольшая сторона, size — размер файла в байтах
+CREATE TABLE attachment_thumbnails (
+    attachment_id INT NOT NULL,
+    max_side INT NOT NULL,
+    storage_key TEXT UNIQUE NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    size BIGINT NOT NULL,
+    PRIMARY KEY (attachment_id, max_side)
+);
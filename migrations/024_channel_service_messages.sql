@@ -0,0 +1,6 @@
+-- Служебные сообщения каналов подписываются от имени канала,
+-- чтобы не раскрывать администратора
+UPDATE messages m SET sender_chat_id = m.chat_id
+FROM chats c
+WHERE c.id = m.chat_id AND c.type = 'channel'
+AND m.action IS NOT NULL AND m.sender_chat_id IS NULL;
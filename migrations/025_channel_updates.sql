@@ -0,0 +1,18 @@
+-- Последовательность обновлений канала. События канала одинаковы для всех
+-- подписчиков, поэтому пишутся один раз в журнал канала, а не в журнал
+-- каждого подписчика.
+ALTER TABLE chats ADD COLUMN pts BIGINT NOT NULL DEFAULT 0;
+
+-- channel_updates: журнал обновлений каждого канала
+CREATE TABLE channel_updates (
+    chat_id INT NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+    pts BIGINT NOT NULL,
+    type TEXT NOT NULL,
+    data JSONB,
+    created_at TIMESTAMP DEFAULT now(),
+    PRIMARY KEY (chat_id, pts)
+);
+
+-- Старые записи журналов периодически удаляются
+CREATE INDEX updates_created_at_idx ON updates (created_at);
+CREATE INDEX channel_updates_created_at_idx ON channel_updates (created_at);